@@ -0,0 +1,88 @@
+package sftps
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+)
+
+// authMethods builds the authentication by the parameters. The signers of the key file and of the agent
+// are offered by a single method because the client tries each method only once.
+// The methods are in the order of publickey, password and keyboard-interactive, when the server replies
+// a partial success (e.g. publickey then password required) the client goes on to the next allowed one.
+// closer releases the agent connection, it must be called after the handshake. interactive wraps the responder
+// of the user, which may wait for a person typing.
+func (this *SecureFtp) authMethods(interactive func(ssh.KeyboardInteractiveChallenge) ssh.KeyboardInteractiveChallenge) (methods []ssh.AuthMethod, closer func(), err error) {
+	var signers []ssh.Signer
+	var agentClient agent.ExtendedAgent
+	closer = func() {}
+
+	if this.params.useKey {
+		var signer ssh.Signer
+		if signer, err = this.loadKey(); err != nil {
+			return
+		}
+		signers = append(signers, signer)
+	}
+
+	if this.params.useAgent {
+		socket := this.params.agentSocket
+		if socket == "" {
+			socket = os.Getenv("SSH_AUTH_SOCK")
+		}
+		if socket == "" {
+			err = errors.New("The ssh-agent is not available, SSH_AUTH_SOCK is not set.")
+			return
+		}
+		var conn net.Conn
+		if conn, err = net.Dial("unix", socket); err != nil {
+			return
+		}
+		closer = func() {
+			conn.Close()
+		}
+		agentClient = agent.NewClient(conn)
+	}
+
+	if len(signers) > 0 || agentClient != nil {
+		methods = append(methods, ssh.PublicKeysCallback(func() (res []ssh.Signer, err error) {
+			res = append(res, signers...)
+			if agentClient != nil {
+				var as []ssh.Signer
+				if as, err = agentClient.Signers(); err != nil {
+					return
+				}
+				res = append(res, as...)
+			}
+			return
+		}))
+	}
+
+	if this.params.pass != "" {
+		methods = append(methods, ssh.Password(this.params.pass))
+	}
+
+	if this.params.useKeyboardInteractive {
+		responder := passwordResponder(this.params.pass)
+		if this.params.challengeResponder != nil {
+			responder = interactive(this.params.challengeResponder)
+		}
+		methods = append(methods, ssh.KeyboardInteractive(responder))
+	}
+	return
+}
+
+// passwordResponder answers the password to every hidden prompt of the keyboard-interactive challenge.
+func passwordResponder(pass string) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) (answers []string, err error) {
+		answers = make([]string, len(questions))
+		for i := range questions {
+			if !echos[i] {
+				answers[i] = pass
+			}
+		}
+		return
+	}
+}
@@ -0,0 +1,70 @@
+package sftps
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CertificateMismatchError is returned when the FTPS server presented a certificate whose public key is not pinned.
+type CertificateMismatchError struct {
+	Host        string
+	Fingerprint string   // "sha256/" fingerprint of the public key the server presented.
+	Want        []string // the pinned fingerprints.
+}
+
+func (this *CertificateMismatchError) Error() string {
+	return fmt.Sprintf("The certificate of %s (%s) does not match the pinned key %s.", this.Host, this.Fingerprint, strings.Join(this.Want, ", "))
+}
+
+// PublicKeyFingerprint returns the fingerprint of the public key of cert for PinnedPublicKeys,
+// "sha256/" and the base64 of the SHA-256 of the SubjectPublicKeyInfo, as curl and HPKP.
+func PublicKeyFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyConnection chains the pinning and the callback to next, they are run on every connection,
+// the resumed data connections too.
+func verifyConnection(next func(tls.ConnectionState) error, host string, pins []string,
+	callback func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) func(tls.ConnectionState) error {
+
+	return func(cs tls.ConnectionState) (err error) {
+		if next != nil {
+			if err = next(cs); err != nil {
+				return
+			}
+		}
+		if len(cs.PeerCertificates) == 0 {
+			err = errors.New("The server presented no certificate.")
+			return
+		}
+		if len(pins) > 0 {
+			// only the leaf is matched, the chain is not verified and the server proves only the key of the leaf.
+			fp := PublicKeyFingerprint(cs.PeerCertificates[0])
+			matched := false
+			for _, pin := range pins {
+				if pin == fp || "sha256/"+strings.TrimPrefix(pin, "sha256//") == fp { // also the "sha256//" of curl and the bare base64.
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				err = &CertificateMismatchError{Host: host, Fingerprint: fp, Want: pins}
+				return
+			}
+		}
+		if callback != nil {
+			rawCerts := make([][]byte, len(cs.PeerCertificates))
+			for i, cert := range cs.PeerCertificates {
+				rawCerts[i] = cert.Raw
+			}
+			err = callback(rawCerts, cs.VerifiedChains)
+		}
+		return
+	}
+}
@@ -0,0 +1,88 @@
+package sftps
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ftp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestVerifyConnectionPins(t *testing.T) {
+	cert := testCertificate(t)
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	b64 := base64.StdEncoding.EncodeToString(sum[:])
+	other := sha256.Sum256([]byte("other"))
+	otherB64 := base64.StdEncoding.EncodeToString(other[:])
+
+	if fp := PublicKeyFingerprint(cert); fp != "sha256/"+b64 {
+		t.Fatalf("fingerprint: %s", fp)
+	}
+	tests := []struct {
+		name  string
+		pins  []string
+		match bool
+	}{
+		{"no pin", nil, true},
+		{"sha256/", []string{"sha256/" + b64}, true},
+		{"curl sha256//", []string{"sha256//" + b64}, true},
+		{"bare base64", []string{b64}, true},
+		{"one of the pins", []string{"sha256/" + otherB64, "sha256/" + b64}, true},
+		{"other sha256/", []string{"sha256/" + otherB64}, false},
+		{"other curl sha256//", []string{"sha256//" + otherB64}, false},
+		{"other bare base64", []string{otherB64}, false},
+	}
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	for _, tt := range tests {
+		err := verifyConnection(nil, "ftp.example.com", tt.pins, nil)(cs)
+		if tt.match {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var mismatch *CertificateMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Errorf("%s: got %v, want CertificateMismatchError", tt.name, err)
+			continue
+		}
+		if mismatch.Host != "ftp.example.com" || mismatch.Fingerprint != "sha256/"+b64 {
+			t.Errorf("%s: got %s %s", tt.name, mismatch.Host, mismatch.Fingerprint)
+		}
+	}
+}
+
+func TestVerifyConnectionNoCertificate(t *testing.T) {
+	if err := verifyConnection(nil, "ftp.example.com", nil, nil)(tls.ConnectionState{}); err == nil {
+		t.Fatal("accepted the connection without a certificate")
+	}
+}
@@ -24,7 +24,11 @@ const (
 
 const (
 	// When handshake to the server
+	//
+	// Deprecated: the timeouts are set by the Timeouts of the parameters.
 	TIMEOUT string = "10s"
 	// The Keep Alive Period for an active network connection.
+	//
+	// Deprecated: the period is set by Timeouts.TCPKeepAlive.
 	KEEPALIVE string = "30s"
 )
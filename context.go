@@ -0,0 +1,58 @@
+package sftps
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// aLongTimeAgo is the deadline for interrupting the blocked I/O immediately.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// watch applies the deadline of ctx, or timeout from now if it is earlier, to conn and interrupts
+// the blocked I/O when ctx is cancelled. The returned func must be called when the operation is finished,
+// the connection stays interrupted if ctx was cancelled already.
+func watch(ctx context.Context, conn net.Conn, timeout time.Duration) (release func()) {
+	if d, ok := deadline(ctx, timeout); ok {
+		conn.SetDeadline(d)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(aLongTimeAgo)
+	})
+	release = func() {
+		if !stop() && ctx.Err() != nil {
+			return
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return
+}
+
+// extend moves the deadline of conn to timeout from now (no deadline if zero) bounded by ctx,
+// the connection stays interrupted if ctx is done.
+func extend(ctx context.Context, conn net.Conn, timeout time.Duration) {
+	d, _ := deadline(ctx, timeout)
+	conn.SetDeadline(d)
+	if ctx.Err() != nil { // cancelled while the deadline was being moved.
+		conn.SetDeadline(aLongTimeAgo)
+	}
+}
+
+// deadline returns the earlier of the deadline of ctx and timeout from now, timeout is ignored if zero.
+func deadline(ctx context.Context, timeout time.Duration) (d time.Time, ok bool) {
+	d, ok = ctx.Deadline()
+	if timeout > 0 {
+		if t := time.Now().Add(timeout); !ok || t.Before(d) {
+			d, ok = t, true
+		}
+	}
+	return
+}
+
+// ctxError prefers the cause of the context over the I/O error it has been triggered.
+func ctxError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -2,9 +2,13 @@ package sftps
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Permission struct {
@@ -23,79 +27,92 @@ type Permissions struct {
 }
 
 type Entity struct {
-	Perms   *Permissions
-	Links   int
-	Owner   string
-	Group   string
-	Size    int
-	LastMod string
-	Name    string
+	Perms      *Permissions
+	Links      int
+	Owner      string
+	Group      string
+	Size       int64
+	LastMod    string    // the time as the server has shown it.
+	ModTime    time.Time // LastMod parsed, the year-less dates of LIST are resolved to the last 12 months.
+	Name       string
+	LinkTarget string            // the destination of the symlink.
+	Facts      map[string]string // the raw facts when listed by MLSD or MLST, the keys are lower case.
 }
 
-func stringToEntities (raw string) (ents []*Entity, err error) {
-	lines := strings.Split(raw, "\r\n")
-
-	if len(lines) == 1 {
-		lines = strings.Split(raw, "\n")
-	}
-
-	for _, line := range lines {
-		if line != "" {
-			ent := new(Entity)
-			var er error
-			ent.Perms, ent.Links, ent.Owner, ent.Group, ent.Size, ent.LastMod, ent.Name, er = decomposition(line)
-			if er != nil {
-				err = er
-				return
-			}
-			ents = append(ents, ent)
-		}
-	}
+func stringToEntities(raw string) (ents []*Entity, err error) {
+	ents, err = parseList(raw, "unix")
 	return
 }
 
-func decomposition(line string) (perms *Permissions, link int, own string, grp string, size int, modified string, name string, err error) {
+// decomposition parses a line of "ls -l", ent is nil if the line is not an entry.
+func decomposition(line string, now time.Time) (ent *Entity, err error) {
 	if line == "" {
 		return
 	}
-	reg := regexp.MustCompile(`^([dplcbs\-])([rwxstST\-]{3})([rwxstST\-]{3})([rwxstST\-]{3})\S*?\s+?(\d+?)\s+?(\S+?)\s+?(\S+?)\s+?(\d+?)\s+?(\S+?\s+?\d+?\s+?(?:\d{2}\:\d{2}|\d{4}))\s+?(.+?)$`)
+	reg := regexp.MustCompile(`^([dplcbs\-])([rwxstST\-]{3})([rwxstST\-]{3})([rwxstST\-]{3})\S*?\s+?(\d+?)\s+?(\S+?)\s+?(\S+?)\s+?(\d+?)\s+?(\S+?\s+?\d+?\s+?(?:\d{1,2}\:\d{2}|\d{4}))\s+?(.+?)$`)
 	cols := reg.FindStringSubmatch(line)
 	if cols == nil {
 		return
 	}
-	if len(cols) == 0 {
-		err = errors.New("Failed to parse the unix file format.")
-		return
-	}
 	cols = cols[1:]
 	if len(cols) != 10 {
 		err = errors.New("Could not parse to json, passed string is unknown format.")
+		return
 	}
 
-	perms = getPermissions(cols[0], cols[1], cols[2], cols[3])
-	link, err = strconv.Atoi(cols[4])
-	if err != nil {
+	ent = new(Entity)
+	ent.Perms = getPermissions(cols[0], cols[1], cols[2], cols[3])
+	if ent.Links, err = strconv.Atoi(cols[4]); err != nil {
 		return
 	}
 
-	own = cols[5]
-	grp = cols[6]
-	size, err = strconv.Atoi(cols[7])
-	if err != nil {
+	ent.Owner = cols[5]
+	ent.Group = cols[6]
+	if ent.Size, err = strconv.ParseInt(cols[7], 10, 64); err != nil {
 		return
 	}
-	modified = cols[8]
-	name = cols[9]
-
+	ent.LastMod = cols[8]
+	if ent.ModTime, err = parseLsTime(cols[8], now); err != nil {
+		return
+	}
+	ent.Name = cols[9]
+	if ent.Perms.Type == "Symlink" {
+		if name, target, ok := strings.Cut(ent.Name, " -> "); ok {
+			ent.Name = name
+			ent.LinkTarget = target
+		}
+	}
 	return
 }
 
+// parseLsTime parses the time of ls like "Jul  9  2016" or "Jul  9 12:30", the latter has no year
+// and is resolved to the latest date not after now (the current time of the client), with a day of grace
+// for the time zones. Feb 29 is resolved to the latest leap year.
+func parseLsTime(val string, now time.Time) (t time.Time, err error) {
+	val = strings.Join(strings.Fields(val), " ")
+	if !strings.Contains(val, ":") {
+		t, err = time.ParseInLocation("Jan 2 2006", val, now.Location())
+		return
+	}
+	var md time.Time
+	if md, err = time.ParseInLocation("Jan 2 15:04", val, now.Location()); err != nil {
+		return
+	}
+	limit := now.AddDate(0, 0, 1)
+	for year := now.Year() + 1; ; year-- {
+		t = time.Date(year, md.Month(), md.Day(), md.Hour(), md.Minute(), 0, 0, now.Location())
+		if t.Month() == md.Month() && !t.After(limit) { // Feb 29 rolls over to Mar 1 but in the leap years.
+			return
+		}
+	}
+}
+
 func getPermissions(tp string, own string, grp string, usr string) (res *Permissions) {
 	res = new(Permissions)
 	res.Type = getFileTypeFromChar(tp)
 	res.Sticky = (usr[2] == 't' || usr[2] == 'T')
-	res.SUID = (usr[2] == 's' || usr[2] == 'S')
-	res.SGID = (grp[2] == 's' || grp[2] == 'G')
+	res.SUID = (own[2] == 's' || own[2] == 'S')
+	res.SGID = (grp[2] == 's' || grp[2] == 'S')
 	res.Users = getPermission(usr)
 	res.Group = getPermission(grp)
 	res.Owner = getPermission(own)
@@ -106,8 +123,68 @@ func getPermission(perm string) (res *Permission) {
 	res = new(Permission)
 	res.Read = perm[0] == 'r'
 	res.Write = perm[1] == 'w'
-	res.Exe = (perm[2] == 'x' || perm[2] == 's')
+	res.Exe = (perm[2] == 'x' || perm[2] == 's' || perm[2] == 't')
+
+	return
+}
+
+// entityToString renders ent as a line of "ls -l", the reverse of decomposition.
+func entityToString(ent *Entity) string {
+	perms := ent.Perms
+	if perms == nil {
+		perms = &Permissions{Owner: new(Permission), Group: new(Permission), Users: new(Permission)}
+	}
+	mode := getCharFromFileType(perms.Type) +
+		permissionToString(perms.Owner, perms.SUID, "s") +
+		permissionToString(perms.Group, perms.SGID, "s") +
+		permissionToString(perms.Users, perms.Sticky, "t")
+	name := ent.Name
+	if ent.LinkTarget != "" {
+		name += " -> " + ent.LinkTarget
+	}
+	return fmt.Sprintf("%s %4d %-8s %-8s %8d %s %s", mode, ent.Links, ent.Owner, ent.Group, ent.Size, ent.LastMod, name)
+}
 
+func permissionToString(perm *Permission, special bool, ch string) (res string) {
+	res = "-"
+	if perm.Read {
+		res = "r"
+	}
+	if perm.Write {
+		res += "w"
+	} else {
+		res += "-"
+	}
+	switch {
+	case special && perm.Exe:
+		res += ch
+	case special:
+		res += strings.ToUpper(ch)
+	case perm.Exe:
+		res += "x"
+	default:
+		res += "-"
+	}
+	return
+}
+
+func getCharFromFileType(tp string) (ch string) {
+	switch tp {
+	case "Directory":
+		ch = "d"
+	case "Symlink":
+		ch = "l"
+	case "Pipe":
+		ch = "p"
+	case "Socket":
+		ch = "s"
+	case "CharacterDevice":
+		ch = "c"
+	case "BlockDevice":
+		ch = "b"
+	default:
+		ch = "-"
+	}
 	return
 }
 
@@ -129,3 +206,293 @@ func getFileTypeFromChar(ch string) (tp string) {
 	}
 	return
 }
+
+func fileInfoToEntity(fi os.FileInfo) (ent *Entity) {
+	ent = new(Entity)
+	ent.Perms = modeToPermissions(fi.Mode())
+	ent.Links = 1
+	ent.Size = fi.Size()
+	ent.LastMod = lsTime(fi.ModTime())
+	ent.ModTime = fi.ModTime()
+	ent.Name = fi.Name()
+	return
+}
+
+func modeToPermissions(mode os.FileMode) (res *Permissions) {
+	res = new(Permissions)
+	switch {
+	case mode&os.ModeDir != 0:
+		res.Type = "Directory"
+	case mode&os.ModeSymlink != 0:
+		res.Type = "Symlink"
+	case mode&os.ModeNamedPipe != 0:
+		res.Type = "Pipe"
+	case mode&os.ModeSocket != 0:
+		res.Type = "Socket"
+	case mode&os.ModeCharDevice != 0:
+		res.Type = "CharacterDevice"
+	case mode&os.ModeDevice != 0:
+		res.Type = "BlockDevice"
+	default:
+		res.Type = "Regular"
+	}
+	res.Sticky = mode&os.ModeSticky != 0
+	res.SUID = mode&os.ModeSetuid != 0
+	res.SGID = mode&os.ModeSetgid != 0
+	res.Owner = modeToPermission(mode >> 6)
+	res.Group = modeToPermission(mode >> 3)
+	res.Users = modeToPermission(mode)
+	return
+}
+
+func modeToPermission(bits os.FileMode) (res *Permission) {
+	res = new(Permission)
+	res.Read = bits&04 != 0
+	res.Write = bits&02 != 0
+	res.Exe = bits&01 != 0
+	return
+}
+
+// mlstWanted are the facts requested by OPTS MLST, in addition to the server defaults.
+var mlstWanted = []string{"type", "size", "modify", "perm", "unix.mode", "unix.owner", "unix.group", "unique"}
+
+// mlstFacts picks the wanted facts out of the ones advertised by FEAT like "type*;size*;modify*;perm;".
+func mlstFacts(offered string) (facts string) {
+	available := map[string]bool{}
+	for _, f := range strings.Split(offered, ";") {
+		available[strings.ToLower(strings.TrimSuffix(f, "*"))] = true
+	}
+	for _, f := range mlstWanted {
+		if available[f] {
+			facts += f + ";"
+		}
+	}
+	return
+}
+
+func mlsdToEntities(raw string) (ents []*Entity, err error) {
+	lines := strings.Split(raw, "\n")
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		var ent *Entity
+		if ent, err = parseMlsx(line); err != nil {
+			return
+		}
+		if tp := strings.ToLower(ent.Facts["type"]); tp == "cdir" || tp == "pdir" {
+			continue // the directory itself and its parent, as SFTP lists neither.
+		}
+		ents = append(ents, ent)
+	}
+	return
+}
+
+// parseMlsx parses the entry of MLSD and MLST (RFC 3659) like "type=file;size=12;modify=20160709123000; name".
+func parseMlsx(line string) (ent *Entity, err error) {
+	var facts, name string
+	var ok bool
+	if facts, name, ok = strings.Cut(line, " "); !ok {
+		err = fmt.Errorf("Could not parse the MLSx entry: %s", line)
+		return
+	}
+
+	ent = new(Entity)
+	ent.Name = name
+	ent.Links = 1
+	ent.Facts = map[string]string{}
+	for _, fact := range strings.Split(facts, ";") {
+		if k, v, ok := strings.Cut(fact, "="); ok {
+			ent.Facts[strings.ToLower(k)] = v
+		}
+	}
+
+	ent.Perms = new(Permissions)
+	if mode, ok := ent.Facts["unix.mode"]; ok {
+		var m uint64
+		if m, err = strconv.ParseUint(mode, 8, 32); err != nil {
+			return
+		}
+		ent.Perms = modeToPermissions(unixModeToFileMode(uint32(m)))
+	} else {
+		perm := ent.Facts["perm"]
+		ent.Perms.Owner = &Permission{
+			Read:  strings.ContainsAny(perm, "rl"),
+			Write: strings.ContainsAny(perm, "wacdfmp"),
+			Exe:   strings.ContainsAny(perm, "e"),
+		}
+		ent.Perms.Group = new(Permission)
+		ent.Perms.Users = new(Permission)
+	}
+
+	switch tp := strings.ToLower(ent.Facts["type"]); {
+	case tp == "dir" || tp == "cdir" || tp == "pdir":
+		ent.Perms.Type = "Directory"
+	case tp == "os.unix=slink" || strings.HasPrefix(tp, "os.unix=symlink"):
+		ent.Perms.Type = "Symlink"
+	case tp == "file":
+		ent.Perms.Type = "Regular"
+	}
+
+	size, ok := ent.Facts["size"]
+	if !ok {
+		size, ok = ent.Facts["sizd"]
+	}
+	if ok {
+		if ent.Size, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return
+		}
+	}
+
+	if modify, ok := ent.Facts["modify"]; ok {
+		if ent.ModTime, err = parseMlsxTime(modify); err != nil {
+			return
+		}
+		ent.LastMod = lsTime(ent.ModTime)
+	}
+
+	ent.Owner = ent.Facts["unix.owner"]
+	if ent.Owner == "" {
+		ent.Owner = ent.Facts["unix.uid"]
+	}
+	ent.Group = ent.Facts["unix.group"]
+	if ent.Group == "" {
+		ent.Group = ent.Facts["unix.gid"]
+	}
+	return
+}
+
+// parseMlsxTime parses the time-val of RFC 3659, YYYYMMDDHHMMSS[.sss] in UTC.
+func parseMlsxTime(val string) (t time.Time, err error) {
+	layout := "20060102150405"
+	if len(val) > len(layout) {
+		layout += ".999999999"
+	}
+	t, err = time.ParseInLocation(layout, val, time.UTC)
+	return
+}
+
+// lsTime formats t in the way of ls, the year is shown instead of the time for the old files.
+func lsTime(t time.Time) string {
+	if time.Since(t) > 180*24*time.Hour || t.After(time.Now()) {
+		return t.Format("Jan _2  2006")
+	}
+	return t.Format("Jan _2 15:04")
+}
+
+// unixModeToFileMode converts the st_mode bits to os.FileMode.
+func unixModeToFileMode(m uint32) (mode os.FileMode) {
+	mode = os.FileMode(m & 0777)
+	if m&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return
+}
+
+// FileInfo returns ent as os.FileInfo, Sys returns ent itself.
+func (this *Entity) FileInfo() os.FileInfo {
+	return entityInfo{this}
+}
+
+// DirEntry returns ent as fs.DirEntry.
+func (this *Entity) DirEntry() fs.DirEntry {
+	return entityInfo{this}
+}
+
+// Mode converts the permissions to os.FileMode.
+func (this *Entity) Mode() (mode os.FileMode) {
+	perms := this.Perms
+	if perms == nil {
+		return
+	}
+	switch perms.Type {
+	case "Directory":
+		mode = os.ModeDir
+	case "Symlink":
+		mode = os.ModeSymlink
+	case "Pipe":
+		mode = os.ModeNamedPipe
+	case "Socket":
+		mode = os.ModeSocket
+	case "CharacterDevice":
+		mode = os.ModeDevice | os.ModeCharDevice
+	case "BlockDevice":
+		mode = os.ModeDevice
+	}
+	mode |= permissionToMode(perms.Owner)<<6 | permissionToMode(perms.Group)<<3 | permissionToMode(perms.Users)
+	if perms.SUID {
+		mode |= os.ModeSetuid
+	}
+	if perms.SGID {
+		mode |= os.ModeSetgid
+	}
+	if perms.Sticky {
+		mode |= os.ModeSticky
+	}
+	return
+}
+
+func (this *Entity) IsDir() bool {
+	return this.Perms != nil && this.Perms.Type == "Directory"
+}
+
+func permissionToMode(perm *Permission) (bits os.FileMode) {
+	if perm == nil {
+		return
+	}
+	if perm.Read {
+		bits |= 04
+	}
+	if perm.Write {
+		bits |= 02
+	}
+	if perm.Exe {
+		bits |= 01
+	}
+	return
+}
+
+// entityInfo adapts Entity to os.FileInfo and fs.DirEntry,
+// Entity cannot implement them itself because its fields are named after the methods.
+type entityInfo struct {
+	ent *Entity
+}
+
+func (this entityInfo) Name() string {
+	return this.ent.Name
+}
+
+func (this entityInfo) Size() int64 {
+	return this.ent.Size
+}
+
+func (this entityInfo) Mode() os.FileMode {
+	return this.ent.Mode()
+}
+
+func (this entityInfo) ModTime() time.Time {
+	return this.ent.ModTime
+}
+
+func (this entityInfo) IsDir() bool {
+	return this.ent.IsDir()
+}
+
+func (this entityInfo) Sys() interface{} {
+	return this.ent
+}
+
+func (this entityInfo) Type() fs.FileMode {
+	return this.ent.Mode().Type()
+}
+
+func (this entityInfo) Info() (fs.FileInfo, error) {
+	return this, nil
+}
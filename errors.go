@@ -0,0 +1,92 @@
+package sftps
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// The errors of both the FTP and SFTP backends are classified by these, test them by errors.Is.
+var (
+	ErrNotConnected     = errors.New("Connection is not established.")
+	ErrAuthFailed       = errors.New("Authentication failed.")
+	ErrPermissionDenied = errors.New("Permission denied.")
+	ErrNotFound         = errors.New("The file or directory does not exist.")
+)
+
+// ProtocolError is the unexpected reply of the FTP server, errors.As tells the reply code.
+type ProtocolError struct {
+	Command string
+	Code    int
+	Msg     string
+}
+
+func (this *ProtocolError) Error() string {
+	if this.Command == "" {
+		return fmt.Sprintf("%d %s", this.Code, this.Msg)
+	}
+	return fmt.Sprintf("%s: %d %s", strings.Fields(this.Command)[0], this.Code, this.Msg)
+}
+
+// Is classifies the reply, 530 is ErrAuthFailed and 550 (or 450) is ErrPermissionDenied or ErrNotFound
+// by the message because the code is shared by both of them.
+func (this *ProtocolError) Is(target error) bool {
+	switch target {
+	case ErrAuthFailed:
+		return this.Code == 530 || this.Code == 430
+	case ErrPermissionDenied:
+		return this.Code == 553 || ((this.Code == 550 || this.Code == 450) && deniedMessage(this.Msg))
+	case ErrNotFound:
+		return (this.Code == 550 || this.Code == 450) && !deniedMessage(this.Msg)
+	}
+	return false
+}
+
+// Transient reports whether the reply is 4xx, the same command may succeed later.
+func (this *ProtocolError) Transient() bool {
+	return this.Code/100 == 4
+}
+
+func deniedMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "denied") || strings.Contains(msg, "permission") || strings.Contains(msg, "not allowed")
+}
+
+// newProtocolError makes the error of the reply, the password of PASS is masked.
+func newProtocolError(cmd string, code int, msg string) error {
+	if strings.HasPrefix(cmd, "PASS ") {
+		cmd = "PASS ****"
+	}
+	return &ProtocolError{Command: cmd, Code: code, Msg: msg}
+}
+
+// classifiedError wraps err of the SFTP backend so that errors.Is tells its kind,
+// the message is that of err.
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (this *classifiedError) Error() string {
+	return this.err.Error()
+}
+
+func (this *classifiedError) Unwrap() []error {
+	return []error{this.kind, this.err}
+}
+
+// sftpError classifies the error of the SFTP server or of the SSH handshake.
+func sftpError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return &classifiedError{kind: ErrNotFound, err: err}
+	case errors.Is(err, fs.ErrPermission):
+		return &classifiedError{kind: ErrPermissionDenied, err: err}
+	case strings.Contains(err.Error(), "ssh: unable to authenticate"):
+		return &classifiedError{kind: ErrAuthFailed, err: err}
+	}
+	return err
+}
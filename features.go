@@ -0,0 +1,50 @@
+package sftps
+
+import (
+	"strings"
+)
+
+// Features is the set of the extensions the server advertised, by FEAT (RFC 2389) on FTP and by the
+// extensions of the SFTP version reply. The name in upper case maps to its parameters, e.g. "REST" to "STREAM",
+// "MLST" to "type*;size*;modify*;" and "AUTH" to "TLS;SSL". It must not be modified.
+type Features map[string]string
+
+// Has reports whether the feature name is supported, and every one of params if given,
+// e.g. Has("SIZE"), Has("REST", "STREAM"), Has("AUTH", "TLS"), Has("MLST", "modify") or Has("HASH", "SHA-256").
+func (this Features) Has(name string, params ...string) bool {
+	p, ok := this[strings.ToUpper(name)]
+	if !ok {
+		return false
+	}
+	for _, want := range params {
+		if !hasParam(p, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasParam looks up want in the parameters separated by semicolons or spaces, the "*" of the
+// facts enabled by default is ignored.
+func hasParam(params string, want string) bool {
+	for _, p := range strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ' ' }) {
+		if strings.EqualFold(strings.TrimSuffix(p, "*"), want) {
+			return true
+		}
+	}
+	return false
+}
+
+// sftpExtensions are the extensions of OpenSSH and the drafts looked up in the SFTP version reply.
+var sftpExtensions = []string{
+	"posix-rename@openssh.com",
+	"statvfs@openssh.com",
+	"fstatvfs@openssh.com",
+	"hardlink@openssh.com",
+	"fsync@openssh.com",
+	"lsetstat@openssh.com",
+	"limits@openssh.com",
+	"expand-path@openssh.com",
+	"copy-data",
+	"check-file",
+}
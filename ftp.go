@@ -1,6 +1,7 @@
 package sftps
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	"net"
 	"net/textproto"
 	"os"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -18,11 +20,19 @@ import (
 
 
 type Ftp struct {
-	rawConn  net.Conn
-	tlsConn  *tls.Conn
-	ctrlConn *textproto.Conn
-	params   *ftpParameters
-	State    int
+	rawConn      net.Conn
+	tlsConn      *tls.Conn
+	ctrlConn     *textproto.Conn
+	params       *ftpParameters
+	epsvRejected bool
+	eprtRejected bool
+	features     Features    // the FEAT reply, feature name to its parameters.
+	system       string      // the SYST reply.
+	workDir      string      // the working directory changed by CWD, restored on the reconnect.
+	tlsConf      *tls.Config // shared by the control and data connections of the session.
+	protected    bool        // the data connections are protected by PROT P.
+	sessions     tls.ClientSessionCache
+	State        int
 }
 
 func newFtp(p *ftpParameters) (ftp *Ftp) {
@@ -34,134 +44,162 @@ func newFtp(p *ftpParameters) (ftp *Ftp) {
 	return
 }
 
-func (this *Ftp) connect() (res *FtpResponse, err error) {
-	var ipaddr []net.IP
-	var code int
-	var msg string
-
-	if ipaddr, err = net.LookupIP(this.params.host); err != nil {
-		return
-	}
-
-	addr := fmt.Sprintf("%s:%d", ipaddr[0], this.params.port)
-
-	dialer := new(net.Dialer)
-	if dialer.Timeout, err = time.ParseDuration(TIMEOUT); err != nil {
-		return
+func (this *Ftp) connect(ctx context.Context) (res *FtpResponse, err error) {
+	if this.ctrlConn != nil {
+		this.ctrlConn.Close() // left by the session failed before.
 	}
-	if dialer.KeepAlive, err = time.ParseDuration(KEEPALIVE); err != nil {
+	this.rawConn, this.tlsConn = nil, nil
+	this.epsvRejected, this.eprtRejected = false, false
+	this.workDir = ""
+	this.tlsConf = nil
+	this.protected = false
+	// the dialer tries every address of the host, IPv6 and IPv4 alike.
+	addr := net.JoinHostPort(this.params.host, strconv.Itoa(this.params.port))
+
+	timeouts := this.params.timeouts
+	var conn net.Conn
+	if conn, err = timeouts.dialer(timeouts.dial()).DialContext(ctx, "tcp", addr); err != nil {
 		return
 	}
+	this.rawConn = conn
 	if this.params.secure && this.params.secureMode == IMPLICIT {
-		var conf *tls.Config
-		if conf, err = this.getTLSConfig(); err != nil {
+		if this.tlsConn, err = this.handshake(ctx, conn); err != nil {
+			conn.Close()
 			return
 		}
-		if this.tlsConn, err = tls.DialWithDialer(dialer, "tcp", addr, conf); err != nil {
-			return
-		}
-		this.ctrlConn = textproto.NewConn(this.tlsConn)
-	} else {
-		if this.rawConn, err = dialer.Dial("tcp", addr); err != nil {
-			return
-		}
-		this.ctrlConn = textproto.NewConn(this.rawConn)
-	}
-	if code, msg, err = this.ctrlConn.ReadResponse(220); err != nil {
-		return
+		conn = this.tlsConn
 	}
+	this.ctrlConn = textproto.NewConn(conn)
 
-	res = &FtpResponse{
-		command: "",
-		code:    code,
-		msg:     msg,
+	release := watch(ctx, conn, timeouts.reply())
+	res, err = this.readReply(ctx, "", 220)
+	release()
+	if err != nil {
+		this.ctrlConn.Close()
+		return
 	}
 
-
-
 	this.State = ONLINE
 	return
 }
 
-func (this *Ftp) secureUpgrade() (err error) {
+func (this *Ftp) secureUpgrade(ctx context.Context) (err error) {
+	if this.tlsConn, err = this.handshake(ctx, this.rawConn); err != nil {
+		return
+	}
+	this.ctrlConn = textproto.NewConn(this.tlsConn)
+	return
+}
+
+// handshake starts TLS on conn within the handshake timeout.
+func (this *Ftp) handshake(ctx context.Context, conn net.Conn) (tlsConn *tls.Conn, err error) {
 	var conf *tls.Config
+	if conf, err = this.tlsConfig(); err != nil {
+		return
+	}
+	tlsConn = tls.Client(conn, conf)
+	release := watch(ctx, conn, this.params.timeouts.handshake())
+	err = ctxError(ctx, tlsConn.Handshake())
+	release()
+	return
+}
+
+// tlsConfig returns the config of the session, the data connections resume the TLS session of the control
+// connection by the shared session cache, keyed by the ServerName, as the servers like vsftpd (require_ssl_reuse)
+// and FileZilla Server require. The cache is kept over the reconnects.
+func (this *Ftp) tlsConfig() (conf *tls.Config, err error) {
+	if this.tlsConf != nil {
+		conf = this.tlsConf
+		return
+	}
 	if conf, err = this.getTLSConfig(); err != nil {
 		return
 	}
-	this.tlsConn = tls.Client(this.rawConn, conf)
-	this.ctrlConn = textproto.NewConn(this.tlsConn)
+	if conf.ClientSessionCache == nil {
+		if this.sessions == nil {
+			this.sessions = tls.NewLRUClientSessionCache(0)
+		}
+		conf.ClientSessionCache = this.sessions
+	}
+	this.tlsConf = conf
 	return
 }
 
+// getTLSConfig builds the TLS config by the parameters, the cipher suites are left to the defaults of Go.
 func (this *Ftp) getTLSConfig() (conf *tls.Config, err error) {
-	var certPair tls.Certificate
-	var certPool *x509.CertPool
-	var rcaPem []byte
-
-	conf = new(tls.Config)
-	conf.ClientAuth = tls.VerifyClientCertIfGiven
-	conf.CipherSuites = []uint16{
-		tls.TLS_RSA_WITH_AES_128_CBC_SHA,
-		tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
-		tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
-		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
-		tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-	}
-
-	if this.params.cert != "" && this.params.key != "" {
-		if certPair, err = tls.LoadX509KeyPair(this.params.cert, this.params.key); err != nil {
-			return
+	if this.params.tlsConfig != nil {
+		conf = this.params.tlsConfig.Clone()
+	} else {
+		conf = &tls.Config{
+			MinVersion:         this.params.tlsMinVersion,
+			MaxVersion:         this.params.tlsMaxVersion,
+			InsecureSkipVerify: this.params.alwaysTrust,
+		}
+		if conf.MinVersion == 0 {
+			conf.MinVersion = tls.VersionTLS12
 		}
 
-		certPool = x509.NewCertPool()
+		if this.params.cert != "" || this.params.key != "" {
+			var certPair tls.Certificate
+			if certPair, err = tls.LoadX509KeyPair(this.params.cert, this.params.key); err != nil {
+				return
+			}
+			conf.Certificates = []tls.Certificate{certPair}
+		}
 
 		if this.params.rootCA != "" {
-			if rcaPem, err = ioutil.ReadFile("./cert/rcaPem.pem"); err != nil {
+			var rcaPem []byte
+			if rcaPem, err = os.ReadFile(this.params.rootCA); err != nil {
 				return
 			}
-
-			if this.params.alwaysTrust {
-				if !certPool.AppendCertsFromPEM(rcaPem) {
-					panic("Failed to parse the Root Certificate")
-				}
+			conf.RootCAs = x509.NewCertPool()
+			if !conf.RootCAs.AppendCertsFromPEM(rcaPem) {
+				err = errors.New("Failed to parse the Root Certificate.")
+				return
 			}
-			conf.RootCAs = certPool
 		}
-
-		conf.Certificates = make([]tls.Certificate, 1)
-		conf.Certificates[0] = certPair
-		conf.ClientCAs = certPool
 	}
-	conf.InsecureSkipVerify = this.params.alwaysTrust
+	if conf.ServerName == "" {
+		conf.ServerName = this.params.serverName
+	}
+	if conf.ServerName == "" {
+		conf.ServerName = this.params.host
+	}
+	if len(this.params.pinnedKeys) > 0 || this.params.verifyPeer != nil {
+		if len(this.params.pinnedKeys) > 0 {
+			conf.InsecureSkipVerify = true // the pins replace the chain verification.
+		}
+		conf.VerifyConnection = verifyConnection(conf.VerifyConnection, conf.ServerName, this.params.pinnedKeys, this.params.verifyPeer)
+	}
 	return
 }
 
-func (this *Ftp) auth() (res []*FtpResponse, err error) {
+func (this *Ftp) auth(ctx context.Context) (res []*FtpResponse, err error) {
 
 	var r *FtpResponse
 
 	res = []*FtpResponse{}
 
 	if this.params.secure && this.params.secureMode == EXPLICIT {
-		if r, err = this.Command("AUTH TLS", 234); err != nil {
+		if r, err = this.CommandContext(ctx, "AUTH TLS", 234); err != nil {
 			return
 		}
 		res = append(res, r)
 
-		if err = this.secureUpgrade(); err != nil {
+		if err = this.secureUpgrade(ctx); err != nil {
 			return
 		}
 	}
 
-	if r, err = this.Command(fmt.Sprintf("USER %s", this.params.user), 331); err != nil {
+	if r, err = this.CommandContext(ctx, fmt.Sprintf("USER %s", this.params.user), 331, 230); err != nil {
 		return
 	}
 	res = append(res, r)
+	if r.Code == 230 { // no password is required.
+		return
+	}
 
-	if r, err = this.Command(fmt.Sprintf("PASS %s", this.params.pass), 230); err != nil {
+	if r, err = this.CommandContext(ctx, fmt.Sprintf("PASS %s", this.params.pass), 230, 202); err != nil {
 		return
 	}
 	res = append(res, r)
@@ -169,402 +207,751 @@ func (this *Ftp) auth() (res []*FtpResponse, err error) {
 	return
 }
 
-func (this *Ftp) Command(cmd string, code int) (res *FtpResponse, err error) {
-	var c int
-	var m string
+// Command sends cmd and reads the reply, it is accepted if the code is one of codes.
+// A code less than 10 accepts the class of the replies (e.g. 2 accepts every 2xx), and every 2xx
+// is accepted if codes is empty. The reply of the other code is returned as *ProtocolError.
+func (this *Ftp) Command(cmd string, codes ...int) (res *FtpResponse, err error) {
+	return this.CommandContext(context.Background(), cmd, codes...)
+}
 
-	if _, err = this.ctrlConn.Cmd(cmd); err != nil {
+// CommandContext is like Command, if ctx is done before the reply arrived
+// the control connection is closed because it cannot be used any longer.
+func (this *Ftp) CommandContext(ctx context.Context, cmd string, codes ...int) (res *FtpResponse, err error) {
+	if this.ctrlConn == nil {
+		err = ErrNotConnected
 		return
 	}
+	release := watch(ctx, this.ctrlNetConn(), this.params.timeouts.reply())
+	defer release()
 
-	if c, m, err = this.ctrlConn.ReadResponse(code); err != nil {
+	if _, err = this.ctrlConn.Cmd("%s", cmd); err != nil {
+		err = this.interrupted(ctx, err)
 		return
 	}
 
+	if res, err = this.readReply(ctx, cmd, codes...); err != nil {
+		return
+	}
+
+	switch strings.ToUpper(strings.Fields(cmd + " ")[0]) {
+	case "CWD", "XCWD", "CDUP", "XCUP":
+		// the directory is remembered by PWD, it is not restored if the server did not tell it.
+		this.workDir = ""
+		if r, e := this.CommandContext(ctx, "PWD", 257); e == nil {
+			this.workDir, _ = parsePwd(r.Msg)
+		} else if ctx.Err() != nil {
+			err = e
+		}
+	}
+	return
+}
+
+// ping checks the control connection by NOOP.
+func (this *Ftp) ping(ctx context.Context) (err error) {
+	_, err = this.CommandContext(ctx, "NOOP", 200)
+	return
+}
+
+// parsePwd reads the directory from the reply like `257 "/home/user" is the current directory.`,
+// the double quote in the name is doubled.
+func parsePwd(msg string) (dir string, err error) {
+	start := strings.Index(msg, "\"")
+	end := strings.LastIndex(msg, "\"")
+	if start < 0 || end <= start {
+		err = fmt.Errorf("Could not parse the PWD reply: %s", msg)
+		return
+	}
+	dir = strings.ReplaceAll(msg[start+1:end], "\"\"", "\"")
+	return
+}
+
+// readReply reads the reply to cmd, see Command for codes.
+func (this *Ftp) readReply(ctx context.Context, cmd string, codes ...int) (res *FtpResponse, err error) {
+	var code int
+	var msg string
+
+	if code, msg, err = this.ctrlConn.ReadResponse(0); err != nil {
+		err = this.interrupted(ctx, err)
+		return
+	}
+	if !acceptable(code, codes) {
+		err = newProtocolError(cmd, code, msg)
+		return
+	}
 	res = &FtpResponse{
-		command: cmd,
-		code:    c,
-		msg:     m,
+		Command: cmd,
+		Code:    code,
+		Msg:     msg,
 	}
 	return
 }
 
-func (this *Ftp) options() (res []*FtpResponse, err error) {
+func acceptable(code int, codes []int) bool {
+	if len(codes) == 0 {
+		return code/100 == 2
+	}
+	for _, c := range codes {
+		if c == code || (c < 10 && code/100 == c) {
+			return true
+		}
+	}
+	return false
+}
+
+// ctrlNetConn returns the connection currently carrying the control channel.
+func (this *Ftp) ctrlNetConn() net.Conn {
+	if this.tlsConn != nil {
+		return this.tlsConn
+	}
+	return this.rawConn
+}
+
+// interrupted closes the control connection when err was caused by ctx or by the timeout,
+// the reply may arrive later and the connection cannot be used any longer.
+func (this *Ftp) interrupted(ctx context.Context, err error) error {
+	var ne net.Error
+	if ctx.Err() == nil && !(errors.As(err, &ne) && ne.Timeout()) {
+		return err
+	}
+	this.closeCtrl()
+	return ctxError(ctx, err)
+}
+
+// cancelled closes the control connection when ctx is done, the transfer may be in progress on the server
+// and its replies cannot be awaited. Sftps relies on the backend closing the connection in that case.
+func (this *Ftp) cancelled(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	this.closeCtrl()
+	return ctxError(ctx, err)
+}
+
+// abandon gives up the transfer the server started, by ABOR, or by closing the control connection if ctx is done.
+func (this *Ftp) abandon(ctx context.Context) (res []*FtpResponse) {
+	if ctx.Err() != nil {
+		this.closeCtrl()
+		return
+	}
+	res, _ = this.abort()
+	return
+}
+
+func (this *Ftp) closeCtrl() {
+	this.ctrlConn.Close()
+	this.State = OFFLINE
+}
+
+// abort cancels the transfer the server started (1xx was received). The server replies for the transfer first
+// (426, 425 when the data connection failed, or 226 when it was finished already) and then for the ABOR itself
+// (225 or 226), both of them are read to keep the replies in step. The control connection is closed if they
+// did not arrive, the later commands would read them otherwise.
+func (this *Ftp) abort() (res []*FtpResponse, err error) {
+	conn := this.ctrlNetConn()
+	if timeout := this.params.timeouts.reply(); timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	defer func() {
+		if err != nil {
+			this.closeCtrl()
+		}
+	}()
+
+	if _, err = this.ctrlConn.Cmd("ABOR"); err != nil {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		var code int
+		var msg string
+		if code, msg, err = this.ctrlConn.ReadResponse(0); err != nil {
+			return
+		}
+		res = append(res, &FtpResponse{Command: "ABOR", Code: code, Msg: msg})
+		if code == 225 { // the reply to the ABOR, no transfer was in progress any longer.
+			return
+		}
+	}
+	return
+}
+
+func (this *Ftp) options(ctx context.Context) (res []*FtpResponse, err error) {
 	var r *FtpResponse
-	if r, err = this.Command("SYST", 215); err != nil {
+	if r, err = this.CommandContext(ctx, "SYST", 215); err != nil {
 		return
 	}
 	res = []*FtpResponse{}
 	res = append(res, r)
+	this.system = r.Msg
 
-	if r, err = this.Command("FEAT", 211); err != nil {
+	// the options below are sent only if advertised, the servers before RFC 2389 reject FEAT.
+	this.features = Features{}
+	if r, err = this.CommandContext(ctx, "FEAT", 211); err == nil {
+		res = append(res, r)
+		this.features = parseFeat(r.Msg)
+	} else if !refused(err) {
 		return
 	}
-	res = append(res, r)
+	err = nil
 
-	if r, err = this.Command("OPTS UTF8 ON", 200); err != nil {
-		return
+	if this.features.Has("UTF8") {
+		if r, e := this.CommandContext(ctx, "OPTS UTF8 ON", 200, 202); e == nil {
+			res = append(res, r)
+		} else if !refused(e) {
+			err = e
+			return
+		}
+	}
+
+	if facts, ok := this.features["MLST"]; ok {
+		// ask for every fact we understand, the server keeps its defaults if it refused.
+		if r, e := this.CommandContext(ctx, fmt.Sprintf("OPTS MLST %s", mlstFacts(facts)), 200); e == nil {
+			res = append(res, r)
+		} else if !refused(e) {
+			err = e
+			return
+		}
 	}
-	res = append(res, r)
 
 	if this.params.secure {
-		if r, err = this.Command("PROT P", 200); err != nil {
+		var rs []*FtpResponse
+		rs, err = this.protect(ctx)
+		res = append(res, rs...)
+		if err != nil {
 			return
 		}
-		res = append(res, r)
 	}
-	if r, err = this.Command("TYPE I", 200); err != nil {
+	if r, err = this.CommandContext(ctx, "TYPE I", 200); err != nil {
 		return
 	}
 	res = append(res, r)
 	return
 }
 
-func (this *Ftp) getLocalIP() (ip string, err error) {
-	var addrs []net.Addr
-	if addrs, err = net.InterfaceAddrs(); err != nil {
+// protect negotiates the protection of the data connections by PBSZ and PROT (RFC 4217),
+// and then clears the control connection by CCC if it was asked.
+func (this *Ftp) protect(ctx context.Context) (res []*FtpResponse, err error) {
+	var r *FtpResponse
+	if r, err = this.CommandContext(ctx, "PBSZ 0", 200); err != nil {
 		return
 	}
-	for _, addr := range addrs {
-		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				ip = ipnet.IP.To4().String()
-			}
-		}
+	res = append(res, r)
+
+	prot := "PROT P"
+	if this.params.clearData {
+		prot = "PROT C"
 	}
-	if ip == "" {
-		err = errors.New("Could not get the Local Address.")
+	if r, err = this.CommandContext(ctx, prot, 200); err != nil {
 		return
 	}
+	res = append(res, r)
+	this.protected = !this.params.clearData
+
+	if this.params.clearCommand {
+		if r, err = this.CommandContext(ctx, "CCC", 200); err != nil {
+			return
+		}
+		res = append(res, r)
+		err = this.clearCommandChannel(ctx)
+	}
 	return
 }
 
-func (this *Ftp) ds2h(dec string) (hex string, err error) {
-	var p int = 0
-	if p, err = strconv.Atoi(dec); err != nil {
+// clearCommandChannel ends TLS on the control connection after CCC, both sides send close_notify
+// and the commands continue in the clear on the same TCP connection.
+func (this *Ftp) clearCommandChannel(ctx context.Context) (err error) {
+	release := watch(ctx, this.rawConn, this.params.timeouts.reply())
+	defer release() // also clears the past write deadline CloseWrite leaves on the connection.
+	if err = this.tlsConn.CloseWrite(); err != nil {
+		err = this.interrupted(ctx, err)
 		return
 	}
-	hex = fmt.Sprintf("%x", p)
+	// the close_notify of the server.
+	if _, err = io.Copy(io.Discard, this.tlsConn); err != nil {
+		err = this.interrupted(ctx, err)
+		return
+	}
+	this.tlsConn = nil
+	this.ctrlConn = textproto.NewConn(this.rawConn)
 	return
 }
 
-func (this *Ftp) h2i(hex string) (res int, err error) {
-	if r, e := strconv.ParseInt(hex, 16, 64); e != nil {
-		return
-	} else {
-		res = int(r)
+// refused reports whether err is the negative reply of the server, the connection is still usable then.
+func refused(err error) bool {
+	var pe *ProtocolError
+	return errors.As(err, &pe) && !connectionLost(err)
+}
+
+// rejected reports whether the server does not implement the command.
+func rejected(err error) bool {
+	var pe *ProtocolError
+	if errors.As(err, &pe) {
+		return pe.Code == 500 || pe.Code == 501 || pe.Code == 502
 	}
-	return
+	return false
 }
 
-func (this *Ftp) getSplitPorts() (port1 int, port2 int, err error) {
-	hex := fmt.Sprintf("%x", this.params.listenPort)
+// port listens on the address the control connection is bound to and tells it to the server,
+// by EPRT (RFC 2428) first and then PORT for IPv4 if the server does not implement EPRT.
+func (this *Ftp) port(ctx context.Context) (res *FtpResponse, listener net.Listener, err error) {
+	local, ok := this.ctrlNetConn().LocalAddr().(*net.TCPAddr)
+	if !ok {
+		err = errors.New("Could not get the Local Address.")
+		return
+	}
+	if listener, err = net.Listen("tcp", net.JoinHostPort(local.IP.String(), strconv.Itoa(this.params.listenPort))); err != nil {
+		return
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	ip4 := local.IP.To4()
 
-	switch len(hex) {
-	case 1, 2:
-		port1 = 0
-		if port2, err = this.h2i(hex); err != nil {
-			return
-		}
-	case 3:
-		p1 := hex[:1]
-		p2 := hex[1:3]
-		if port1, err = this.h2i(p1); err != nil {
-			return
+	if this.params.extended && !this.eprtRejected {
+		proto := 2
+		if ip4 != nil {
+			proto = 1
 		}
-		if port2, err = this.h2i(p2); err != nil {
+		if res, err = this.CommandContext(ctx, fmt.Sprintf("EPRT |%d|%s|%d|", proto, local.IP, port), 200); err == nil {
 			return
 		}
-	case 4:
-		p1 := hex[:2]
-		p2 := hex[2:4]
-		if port1, err = this.h2i(p1); err != nil {
+		if !rejected(err) || ip4 == nil {
+			listener.Close()
 			return
 		}
-		if port2, err = this.h2i(p2); err != nil {
-			return
-		}
-	default:
-		err = errors.New("The Port Number could not converted to the Parameter Format for the Listen Function.")
+		this.eprtRejected = true
 	}
-	return
-}
-
-func (this *Ftp) port() (res *FtpResponse, listener net.Listener, err error) {
-	var localIP string = ""
-	if localIP, err = this.getLocalIP(); err != nil {
+	if ip4 == nil {
+		listener.Close()
+		err = errors.New("The PORT command supports IPv4 only, EPRT is required for IPv6.")
 		return
 	}
 
-	ip := strings.Replace(localIP, ".", ",", -1)
-	var p1, p2 int
-	if p1, p2, err = this.getSplitPorts(); err != nil {
+	cmd := fmt.Sprintf("PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff)
+	if res, err = this.CommandContext(ctx, cmd, 200); err != nil {
+		listener.Close()
 		return
 	}
-	cmd := fmt.Sprintf("PORT %s,%d,%d", ip, p1, p2)
+	return
+}
 
-	if res, err = this.Command(cmd, 200); err != nil {
+// pasv opens the data connection to the server, the address is asked by EPSV (RFC 2428) first
+// and by PASV if the server does not implement EPSV. The host is always the one of the control connection.
+func (this *Ftp) pasv(ctx context.Context) (res *FtpResponse, dataConn net.Conn, err error) {
+	var host string
+	var port int
+
+	if host, _, err = net.SplitHostPort(this.ctrlNetConn().RemoteAddr().String()); err != nil {
 		return
 	}
-	if listener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", localIP, this.params.listenPort)); err != nil {
+
+	if this.params.extended && !this.epsvRejected {
+		if res, err = this.CommandContext(ctx, "EPSV", 229); err == nil {
+			port, err = parseEpsv(res.Msg)
+		} else if rejected(err) && net.ParseIP(host).To4() != nil {
+			this.epsvRejected = true
+		}
+	}
+	if !this.params.extended || this.epsvRejected {
+		if res, err = this.CommandContext(ctx, "PASV", 227); err == nil {
+			port, err = parsePasv(res.Msg)
+		}
+	}
+	if err != nil {
 		return
 	}
 
+	timeouts := this.params.timeouts
+	dataConn, err = timeouts.dialer(timeouts.dataConn()).DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 	return
 }
 
-func (this *Ftp) pasv() (res *FtpResponse, dataConn net.Conn, err error) {
-	if res, err = this.Command("PASV", 227); err != nil {
+// parseEpsv reads the port from the reply like "229 Entering Extended Passive Mode (|||6446|)".
+func parseEpsv(msg string) (port int, err error) {
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	if start < 0 || end < start+2 {
+		err = fmt.Errorf("Could not parse the EPSV reply: %s", msg)
 		return
 	}
-	var ip []net.IP
-	if ip, err = net.LookupIP(this.params.host); err != nil {
+	inner := msg[start+1 : end]
+	fields := strings.Split(inner, inner[:1])
+	if len(fields) != 5 {
+		err = fmt.Errorf("Could not parse the EPSV reply: %s", msg)
 		return
 	}
-	reg := regexp.MustCompile("([0-9]+?),([0-9]+?),([0-9]+?),([0-9]+?),([0-9]+?),([0-9]+)")
-	matches := reg.FindAllStringSubmatch(res.msg, -1)
-	tmp := matches[0]
+	port, err = strconv.Atoi(fields[3])
+	return
+}
 
-	var hex1 string = ""
-	var hex2 string = ""
-	if hex1, err = this.ds2h(tmp[5]); err != nil {
+// parsePasv reads the port from the reply like "227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)".
+func parsePasv(msg string) (port int, err error) {
+	reg := regexp.MustCompile("([0-9]+),([0-9]+),([0-9]+),([0-9]+),([0-9]+),([0-9]+)")
+	matches := reg.FindStringSubmatch(msg)
+	if matches == nil {
+		err = fmt.Errorf("Could not parse the PASV reply: %s", msg)
 		return
 	}
-	if hex2, err = this.ds2h(tmp[6]); err != nil {
+	var p1, p2 int
+	if p1, err = strconv.Atoi(matches[5]); err != nil {
 		return
 	}
-	var port int
-	if port, err = this.h2i(fmt.Sprintf("%s%s", hex1, hex2)); err != nil {
+	if p2, err = strconv.Atoi(matches[6]); err != nil {
 		return
 	}
-	param := fmt.Sprintf("%s:%d", ip[0], port)
-
-	dataConn, err = net.Dial("tcp", param)
+	port = p1<<8 | p2
 	return
 }
 
-func (this *Ftp) readBytes(itf interface{}) (res *FtpResponse, bytes []byte, err error) {
-	var dataConn net.Conn
+// openDataConn prepares the data connection, sends the transfer command and
+// returns the data stream, the final reply is read when the stream is closed.
+// The transfer starts at offset by sending REST in front of cmd when offset is greater than zero.
+func (this *Ftp) openDataConn(ctx context.Context, cmd string, offset int64) (res []*FtpResponse, dc *ftpDataConn, err error) {
+	var r *FtpResponse
+	var conn net.Conn
+	var listener net.Listener
+	defer func() {
+		if err != nil {
+			err = this.cancelled(ctx, err)
+		}
+	}()
 
 	if this.params.passive {
-		if dc, ok := itf.(net.Conn); ok {
-			dataConn = dc
-		} else {
-			err = errors.New("Invalid parameter were bound, net.Conn is not found.")
+		if r, conn, err = this.pasv(ctx); err != nil {
 			return
 		}
-
 	} else {
-		if listener, ok := itf.(net.Listener); ok {
-			if dataConn, err = listener.Accept(); err != nil {
-				return
-			}
-		} else {
-			err = errors.New("Invalid parameter were bound, net.Listener is not found.")
+		if r, listener, err = this.port(ctx); err != nil {
 			return
 		}
 	}
+	res = append(res, r)
 
-	defer dataConn.Close()
-	if this.params.secure {
-		var conf *tls.Config
-		if conf, err = this.getTLSConfig(); err != nil {
-			return
+	if offset > 0 {
+		if r, err = this.CommandContext(ctx, fmt.Sprintf("REST %d", offset), 350); err == nil {
+			res = append(res, r)
 		}
-		dataTLS := tls.Client(dataConn, conf)
-		defer dataTLS.Close()
+	}
+	if err == nil {
+		// 125 when the data connection is already open, 150 when it is about to be opened.
+		r, err = this.CommandContext(ctx, cmd, 125, 150)
+	}
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		if listener != nil {
+			listener.Close()
+		}
+		return
+	}
+	res = append(res, r)
 
-		if bytes, err = ioutil.ReadAll(dataTLS); err != nil {
+	if listener != nil {
+		if conn, err = this.accept(ctx, listener); err != nil {
+			res = append(res, this.abandon(ctx)...)
 			return
 		}
-		dataTLS.Close() // Important the Buffer flush out.
+	}
 
-	} else {
-		if bytes, err = ioutil.ReadAll(dataConn); err != nil {
+	dc = &ftpDataConn{ftp: this, ctx: ctx, conn: conn, rw: conn, idle: this.params.timeouts.dataIdle()}
+	if this.protected {
+		var tlsConn *tls.Conn
+		if tlsConn, err = this.handshake(ctx, conn); err != nil {
+			conn.Close()
+			res = append(res, this.abandon(ctx)...)
+			dc = nil
 			return
 		}
-		dataConn.Close() // Important the Buffer flush out.
+		dc.rw = tlsConn
 	}
+	dc.release = watch(ctx, conn, 0)
+	return
+}
 
-	c, m, e := this.ctrlConn.ReadResponse(226)
-	if e != nil {
-		err = e
-		return
+// accept waits for the server to connect in the active mode, the listener is closed on return.
+func (this *Ftp) accept(ctx context.Context, listener net.Listener) (conn net.Conn, err error) {
+	defer listener.Close()
+
+	if d, ok := deadline(ctx, this.params.timeouts.dataConn()); ok {
+		if l, ok := listener.(*net.TCPListener); ok {
+			l.SetDeadline(d)
+		}
 	}
-	res = &FtpResponse{
-		command: "",
-		code:    c,
-		msg:     m,
+	stop := context.AfterFunc(ctx, func() {
+		listener.Close()
+	})
+	defer stop()
+
+	conn, err = listener.Accept()
+	err = ctxError(ctx, err)
+	return
+}
+
+// ftpDataConn is the data channel of a single transfer.
+type ftpDataConn struct {
+	ftp     *Ftp
+	ctx     context.Context
+	release func()
+	conn    net.Conn
+	rw      io.ReadWriteCloser
+	res     *FtpResponse
+	closed  bool
+	idle    time.Duration
+}
+
+// touch extends the deadline of the data connection by the idle timeout.
+func (this *ftpDataConn) touch() {
+	if this.idle > 0 {
+		extend(this.ctx, this.conn, this.idle)
+	}
+}
+
+func (this *ftpDataConn) Read(p []byte) (n int, err error) {
+	this.touch()
+	n, err = this.rw.Read(p)
+	if err != io.EOF {
+		err = ctxError(this.ctx, err)
 	}
 	return
 }
 
-func (this *Ftp) quit() (res *FtpResponse, err error) {
+func (this *ftpDataConn) Write(p []byte) (n int, err error) {
+	this.touch()
+	n, err = this.rw.Write(p)
+	err = ctxError(this.ctx, err)
+	return
+}
 
+// Close flushes and closes the data channel, then reads the transfer complete reply.
+// The control connection is closed instead if the context of the transfer is done, see cancelled.
+func (this *ftpDataConn) Close() (err error) {
+	if this.closed {
+		return
+	}
+	this.closed = true
+	this.release()
+
+	if this.ctx.Err() != nil {
+		this.conn.Close()
+		err = this.ftp.cancelled(this.ctx, this.ctx.Err())
+		return
+	}
+
+	this.rw.Close() // Important the Buffer flush out.
+	this.conn.Close()
+
+	release := watch(this.ctx, this.ftp.ctrlNetConn(), this.ftp.params.timeouts.reply())
+	defer release()
+	// 250 is sent by some servers instead of 226.
+	this.res, err = this.ftp.readReply(this.ctx, "", 226, 250)
+	return
+}
+
+func (this *Ftp) quit(ctx context.Context) (res *FtpResponse, err error) {
+	if this.ctrlConn == nil {
+		err = ErrNotConnected
+		return
+	}
 	defer this.ctrlConn.Close()
 
-	if this.params.secure {
+	if this.tlsConn != nil {
 		defer this.tlsConn.Close()
 	}
-	if this.params.secureMode != IMPLICIT {
+	if this.rawConn != nil {
 		defer this.rawConn.Close()
 	}
 
-	if res, err = this.Command("QUIT", 221); err != nil {
+	if res, err = this.CommandContext(ctx, "QUIT", 221, 200); err != nil {
 		return
 	}
 	return
 }
 
-func (this *Ftp) list(p string) (res []*FtpResponse, list string, err error) {
-	res = []*FtpResponse{}
-
-	if !this.params.keepAlive {
-		defer func () {
-			var r *FtpResponse
-			if r, err = this.quit(); err != nil {
-				return
-			}
-			res = append(res, r)
-			return
-		}()
-	}
-
-	var itf interface{}
+func (this *Ftp) list(ctx context.Context, p string) (res []*FtpResponse, list string, err error) {
+	var dc *ftpDataConn
 	var bytes []byte
-	var r *FtpResponse
-	res = []*FtpResponse{}
 
 	cmd := fmt.Sprintf("LIST -aL %s", p)
 
-	if this.params.passive {
-		if r, itf, err = this.pasv(); err != nil {
-			return
-		}
-	} else {
-		if r, itf, err = this.port(); err != nil {
-			return
-		}
+	if res, dc, err = this.openDataConn(ctx, cmd, 0); err != nil {
+		return
 	}
-	res = append(res, r)
+	bytes, err = ioutil.ReadAll(dc)
+	if e := dc.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+	res = append(res, dc.res)
+
+	list = string(bytes)
 
-	if r, err = this.Command(cmd, 150); err != nil {
+	return
+}
+
+func (this *Ftp) download(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	var f *os.File
+	if f, err = os.Create(local); err != nil {
 		return
 	}
-	res = append(res, r)
+	defer f.Close()
 
-	if r, bytes, err = this.readBytes(itf); err != nil {
+	res, len, err = this.downloadTo(ctx, f, remote, 0)
+	return
+}
+
+func (this *Ftp) upload(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	var f *os.File
+	if f, err = os.Open(local); err != nil {
 		return
 	}
-	res = append(res, r)
+	defer f.Close()
 
-	list = string(bytes)
+	res, len, err = this.uploadFrom(ctx, f, remote, false)
+	return
+}
 
+// downloadTo retrieves remote from offset into w.
+func (this *Ftp) downloadTo(ctx context.Context, w io.Writer, remote string, offset int64) (res []*FtpResponse, len int64, err error) {
+	var dc *ftpDataConn
+	if res, dc, err = this.openDataConn(ctx, fmt.Sprintf("RETR %s", remote), offset); err != nil {
+		return
+	}
+	len, err = io.Copy(w, dc)
+	if e := dc.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+	res = append(res, dc.res)
 	return
 }
 
-func (this *Ftp) download(local string, remote string) (res []*FtpResponse, len int64, err error) {
-	res = []*FtpResponse{}
-	if !this.params.keepAlive {
-		defer func() {
-			var r *FtpResponse
-			if r, err = this.quit(); err != nil {
-				return
-			}
-			res = append(res, r)
-			return
-		}()
+// uploadFrom stores r to remote, it is appended to the existing remote file by APPE if appending is true.
+func (this *Ftp) uploadFrom(ctx context.Context, r io.Reader, remote string, appending bool) (res []*FtpResponse, len int64, err error) {
+	var dc *ftpDataConn
+	cmd := fmt.Sprintf("STOR %s", remote)
+	if appending {
+		cmd = fmt.Sprintf("APPE %s", remote)
+	}
+	if res, dc, err = this.openDataConn(ctx, cmd, 0); err != nil {
+		return
+	}
+	len, err = io.Copy(dc, r)
+	if e := dc.Close(); err == nil {
+		err = e
 	}
+	if err != nil {
+		return
+	}
+	res = append(res, dc.res)
+	return
+}
 
-	var itf interface{}
+func (this *Ftp) size(ctx context.Context, remote string) (res *FtpResponse, size int64, err error) {
+	if res, err = this.CommandContext(ctx, fmt.Sprintf("SIZE %s", remote), 213); err != nil {
+		return
+	}
+	size, err = strconv.ParseInt(strings.TrimSpace(res.Msg), 10, 64)
+	return
+}
+
+// resumeDownload continues the download from the end of the local file by REST and RETR.
+func (this *Ftp) resumeDownload(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	var f *os.File
 	var r *FtpResponse
+	var rs []*FtpResponse
+	var offset, size int64
 
-	if this.params.passive {
-		if r, itf, err = this.pasv(); err != nil {
-			return
-		}
-	} else {
-		if r, itf, err = this.port(); err != nil {
-			return
-		}
+	if f, err = os.OpenFile(local, os.O_WRONLY|os.O_CREATE, 0666); err != nil {
+		return
 	}
-	res = append(res, r)
-	var cmd = fmt.Sprintf("RETR %s", remote)
-	if r, err = this.Command(cmd, 150); err != nil {
-		spew.Dump(err)
+	defer f.Close()
+	if offset, err = f.Seek(0, io.SeekEnd); err != nil {
 		return
 	}
-	res = append(res, r)
 
-	if r, len, err = this.fileTransfer(DOWNLOAD, local, itf); err != nil {
+	if r, size, err = this.size(ctx, remote); err != nil {
 		return
 	}
 	res = append(res, r)
+	if offset == size {
+		return
+	}
+	if offset > size {
+		err = errors.New("The local file is larger than the remote file, could not resume the download.")
+		return
+	}
+
+	rs, len, err = this.downloadTo(ctx, f, remote, offset)
+	res = append(res, rs...)
 	return
 }
 
-func (this *Ftp) upload(local string, remote string) (res []*FtpResponse, len int64, err error) {
-	res = []*FtpResponse{}
-	if !this.params.keepAlive {
-		defer func() {
-			var r *FtpResponse
-			if r, err = this.quit(); err != nil {
-				return
-			}
-			res = append(res, r)
-			return
-		}()
-	}
-
-	var itf interface{}
+// resumeUpload continues the upload from the end of the remote file by APPE.
+func (this *Ftp) resumeUpload(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	var f *os.File
+	var fi os.FileInfo
 	var r *FtpResponse
+	var rs []*FtpResponse
+	var offset int64
 
-	if this.params.passive {
-		if r, itf, err = this.pasv(); err != nil {
+	if f, err = os.Open(local); err != nil {
+		return
+	}
+	defer f.Close()
+	if fi, err = f.Stat(); err != nil {
+		return
+	}
+
+	if r, offset, err = this.size(ctx, remote); err != nil {
+		var pe *ProtocolError
+		if !errors.As(err, &pe) || pe.Code != 550 {
 			return
 		}
+		offset, err = 0, nil // the remote file does not exist yet.
 	} else {
-		if r, itf, err = this.port(); err != nil {
-			return
-		}
+		res = append(res, r)
 	}
-	res = append(res, r)
-	var cmd = fmt.Sprintf("STOR %s", remote)
-	if r, err = this.Command(cmd, 150); err != nil {
-		spew.Dump(err)
+	if offset == fi.Size() {
 		return
 	}
-	res = append(res, r)
-
-	if r, len, err = this.fileTransfer(UPLOAD, local, itf); err != nil {
+	if offset > fi.Size() {
+		err = errors.New("The remote file is larger than the local file, could not resume the upload.")
 		return
 	}
-	res = append(res, r)
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+
+	rs, len, err = this.uploadFrom(ctx, f, remote, offset > 0)
+	res = append(res, rs...)
 	return
 }
 
-func (this *Ftp) mkdir(p string) (res *FtpResponse, err error) {
-	res, err = this.Command(fmt.Sprintf("MKD %s", p), 257)
+func (this *Ftp) mkdir(ctx context.Context, p string) (res *FtpResponse, err error) {
+	res, err = this.CommandContext(ctx, fmt.Sprintf("MKD %s", p), 257)
 	return
 }
 
-func (this *Ftp) rmdir(p string) (res *FtpResponse, err error) {
-	res, err = this.Command(fmt.Sprintf("RMD %s", p), 250)
+func (this *Ftp) rmdir(ctx context.Context, p string) (res *FtpResponse, err error) {
+	res, err = this.CommandContext(ctx, fmt.Sprintf("RMD %s", p), 250, 200)
 	return
 }
 
-func (this *Ftp) delete(p string) (res *FtpResponse, err error) {
-	res, err = this.Command(fmt.Sprintf("DELE %s", p), 200)
+func (this *Ftp) delete(ctx context.Context, p string) (res *FtpResponse, err error) {
+	res, err = this.CommandContext(ctx, fmt.Sprintf("DELE %s", p), 250, 200)
 	return
 }
 
-func (this *Ftp) rename(old, new string) (res []*FtpResponse, err error) {
-	r := &FtpResponse{}
-	if r, err = this.Command(fmt.Sprintf("RNFR %s", old), 350); err !=  nil {
+func (this *Ftp) rename(ctx context.Context, old, new string) (res []*FtpResponse, err error) {
+	var r *FtpResponse
+	if r, err = this.CommandContext(ctx, fmt.Sprintf("RNFR %s", old), 350); err !=  nil {
 		return
 	}
 	res = append(res, r)
-	if r, err = this.Command(fmt.Sprintf("RNTO %s", new), 250); err != nil {
+	if r, err = this.CommandContext(ctx, fmt.Sprintf("RNTO %s", new), 250, 200); err != nil {
 		return
 	}
 	res = append(res, r)
@@ -573,78 +960,350 @@ func (this *Ftp) rename(old, new string) (res []*FtpResponse, err error) {
 
 
 
+func (this *Ftp) stat(ctx context.Context, p string) (res []*FtpResponse, ent *Entity, err error) {
+	var list string
+	var ents []*Entity
 
-func (this *Ftp) fileTransfer(direction int, uri string, itf interface{}) (res *FtpResponse, len int64, err error) {
-
-	var dataConn net.Conn
-
-	if this.params.passive {
-		if c, ok := itf.(net.Conn); ok {
-			dataConn = c
-			defer dataConn.Close()
-		} else {
-			err = errors.New("Invalid parameter were bound, Value of the argument 'itf' must be the Type 'net.Conn' when the Passive Mode specified by the Parameter.")
+	if this.features.Has("MLST") {
+		var r *FtpResponse
+		if r, err = this.CommandContext(ctx, fmt.Sprintf("MLST %s", p), 250); err != nil {
 			return
 		}
-	} else {
-		if listener, ok := itf.(net.Listener); ok {
-			defer listener.Close()
-			if dataConn, err = listener.Accept(); err != nil {
+		res = append(res, r)
+		// the facts line is the only one indented by a space.
+		for _, line := range strings.Split(r.Msg, "\n") {
+			if strings.HasPrefix(line, " ") {
+				if ent, err = parseMlsx(strings.TrimPrefix(line, " ")); err != nil {
+					return
+				}
+				ent.Name = path.Base(ent.Name)
 				return
 			}
-		} else {
-			err = errors.New("Invalid parameter were bound, Value of the argument 'itf' must be the Type 'net.Listener' whern the Active Mode speciffied by the Parameter")
-			return
 		}
+		err = fmt.Errorf("Could not parse the MLST reply: %s", r.Msg)
+		return
 	}
 
-	var r io.ReadCloser
-	var w io.WriteCloser
-	var rw io.ReadWriteCloser = dataConn
-
-	if this.params.secure {
-		var conf *tls.Config
-		if conf, err = this.getTLSConfig(); err != nil {
+	// the entry is looked up in the listing of the parent, LIST of a directory tells its contents.
+	// Only the root, which has no parent, is told by its "." entry.
+	p = path.Clean(p)
+	dir, name := path.Dir(p), path.Base(p)
+	if dir == p {
+		name = "."
+	}
+	if res, list, err = this.list(ctx, dir); err != nil {
+		return
+	}
+	if ents, err = this.parseList(list); err != nil {
+		return
+	}
+	for _, e := range ents {
+		// some servers tell the entries by the full path.
+		if path.Base(e.Name) == name {
+			ent = e
+			ent.Name = path.Base(p)
 			return
 		}
-		dataTLS := tls.Client(dataConn, conf)
-		defer dataTLS.Close()
-		rw = dataTLS
 	}
+	err = ErrNotFound
+	return
+}
 
-	if direction == DOWNLOAD {
-		if w, err = os.Create(uri); err != nil {
+// listEntities lists dir by MLSD if the server advertised MLST, by LIST otherwise.
+func (this *Ftp) listEntities(ctx context.Context, dir string) (res []*FtpResponse, ents []*Entity, err error) {
+	if !this.features.Has("MLST") {
+		var list string
+		if res, list, err = this.list(ctx, dir); err != nil {
 			return
 		}
-		r = rw
-	} else if direction == UPLOAD {
-		spew.Dump("UPLOAD")
-		if r, err = os.Open(uri); err != nil {
+		var all []*Entity
+		if all, err = this.parseList(list); err != nil {
 			return
 		}
-		w = rw
-	} else {
-		err = errors.New("The Argument 'direction' must be the either 'DOWNLOAD' or 'UPLOAD'.")
+		for _, ent := range all {
+			if ent.Name != "." && ent.Name != ".." { // listed by -a, SFTP lists neither.
+				ents = append(ents, ent)
+			}
+		}
 		return
 	}
 
-	if len, err = io.Copy(w, r); err != nil {
+	var dc *ftpDataConn
+	var bytes []byte
+	if res, dc, err = this.openDataConn(ctx, fmt.Sprintf("MLSD %s", dir), 0); err != nil {
 		return
 	}
-	r.Close()
-	w.Close()
+	bytes, err = ioutil.ReadAll(dc)
+	if e := dc.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+	res = append(res, dc.res)
 
-	var code int
-	var msg string
-	if code, msg, err = this.ctrlConn.ReadResponse(226); err != nil {
+	ents, err = mlsdToEntities(string(bytes))
+	return
+}
+
+// parseList parses the LIST reply by the format specified by the parameter,
+// or by the one that suits the SYST reply.
+func (this *Ftp) parseList(list string) (ents []*Entity, err error) {
+	prefer := this.params.listFormat
+	if prefer == "" {
+		prefer = listParserForSyst(this.system)
+	}
+	ents, err = parseList(list, prefer)
+	return
+}
+
+// parseFeat reads the features from the FEAT reply, one feature per line indented by a space.
+// The parameters of the feature listed more than once (e.g. "AUTH TLS" and "AUTH SSL") are joined by semicolons.
+func parseFeat(msg string) (features Features) {
+	features = Features{}
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		name, params, _ := strings.Cut(line, " ")
+		name = strings.ToUpper(name)
+		if prev, ok := features[name]; ok && prev != "" && params != "" {
+			params = prev + ";" + params
+		}
+		features[name] = params
+	}
+	return
+}
+
+// Features returns the features the server advertised by FEAT, empty if the server does not implement FEAT.
+func (this *Ftp) Features() Features {
+	return this.features
+}
+
+func (this *Ftp) Connect() (res []*FtpResponse, err error) {
+	return this.ConnectContext(context.Background())
+}
+
+func (this *Ftp) ConnectContext(ctx context.Context) (res []*FtpResponse, err error) {
+	var r *FtpResponse
+	var rs []*FtpResponse
+
+	if r, err = this.connect(ctx); err != nil {
 		return
 	}
-	res = &FtpResponse{
-		command: "",
-		code:    code,
-		msg:     msg,
+	res = append(res, r)
+
+	if rs, err = this.auth(ctx); err != nil {
+		this.ctrlConn.Close()
+		this.State = OFFLINE
+		return
+	}
+	res = append(res, rs...)
+
+	if rs, err = this.options(ctx); err != nil {
+		this.ctrlConn.Close()
+		this.State = OFFLINE
+		return
+	}
+	res = append(res, rs...)
+	return
+}
+
+// Reconnect closes the connection without QUIT, connects and authenticates again,
+// and then restores the working directory changed by CWD.
+func (this *Ftp) Reconnect() (res []*FtpResponse, err error) {
+	return this.ReconnectContext(context.Background())
+}
+
+func (this *Ftp) ReconnectContext(ctx context.Context) (res []*FtpResponse, err error) {
+	dir := this.workDir
+	if this.ctrlConn != nil {
+		this.ctrlConn.Close()
+	}
+	this.State = OFFLINE
+
+	if res, err = this.ConnectContext(ctx); err != nil {
+		return
+	}
+	if dir != "" {
+		var r *FtpResponse
+		if r, err = this.CommandContext(ctx, fmt.Sprintf("CWD %s", dir), 250, 200); err != nil {
+			return
+		}
+		res = append(res, r)
+	}
+	return
+}
+
+func (this *Ftp) Quit() (res *FtpResponse, err error) {
+	return this.QuitContext(context.Background())
+}
+
+func (this *Ftp) QuitContext(ctx context.Context) (res *FtpResponse, err error) {
+	res, err = this.quit(ctx)
+	this.State = OFFLINE
+	return
+}
+
+func (this *Ftp) List(p string) (res []*FtpResponse, list string, err error) {
+	return this.ListContext(context.Background(), p)
+}
+
+func (this *Ftp) ListContext(ctx context.Context, p string) (res []*FtpResponse, list string, err error) {
+	res, list, err = this.list(ctx, p)
+	return
+}
+
+func (this *Ftp) Mkdir(p string) (res []*FtpResponse, err error) {
+	return this.MkdirContext(context.Background(), p)
+}
+
+func (this *Ftp) MkdirContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	var r *FtpResponse
+	if r, err = this.mkdir(ctx, p); err != nil {
+		return
+	}
+	res = append(res, r)
+	return
+}
+
+func (this *Ftp) Rmdir(p string) (res []*FtpResponse, err error) {
+	return this.RmdirContext(context.Background(), p)
+}
+
+func (this *Ftp) RmdirContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	var r *FtpResponse
+	if r, err = this.rmdir(ctx, p); err != nil {
+		return
+	}
+	res = append(res, r)
+	return
+}
+
+func (this *Ftp) Rename(old string, new string) (res []*FtpResponse, err error) {
+	return this.RenameContext(context.Background(), old, new)
+}
+
+func (this *Ftp) RenameContext(ctx context.Context, old string, new string) (res []*FtpResponse, err error) {
+	res, err = this.rename(ctx, old, new)
+	return
+}
+
+func (this *Ftp) Upload(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.UploadContext(context.Background(), local, remote)
+}
+
+func (this *Ftp) UploadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	res, len, err = this.upload(ctx, local, remote)
+	return
+}
+
+func (this *Ftp) Download(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.DownloadContext(context.Background(), local, remote)
+}
+
+func (this *Ftp) DownloadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	res, len, err = this.download(ctx, local, remote)
+	return
+}
+
+func (this *Ftp) Stat(p string) (res []*FtpResponse, ent *Entity, err error) {
+	return this.StatContext(context.Background(), p)
+}
+
+func (this *Ftp) StatContext(ctx context.Context, p string) (res []*FtpResponse, ent *Entity, err error) {
+	res, ent, err = this.stat(ctx, p)
+	return
+}
+
+func (this *Ftp) Remove(p string) (res []*FtpResponse, err error) {
+	return this.RemoveContext(context.Background(), p)
+}
+
+func (this *Ftp) RemoveContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	var r *FtpResponse
+	if r, err = this.delete(ctx, p); err != nil {
+		return
 	}
+	res = append(res, r)
 	return
 }
 
+func (this *Ftp) UploadFrom(r io.Reader, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.UploadFromContext(context.Background(), r, remote)
+}
 
+func (this *Ftp) UploadFromContext(ctx context.Context, r io.Reader, remote string) (res []*FtpResponse, len int64, err error) {
+	res, len, err = this.uploadFrom(ctx, r, remote, false)
+	return
+}
+
+func (this *Ftp) DownloadTo(w io.Writer, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.DownloadToContext(context.Background(), w, remote)
+}
+
+func (this *Ftp) DownloadToContext(ctx context.Context, w io.Writer, remote string) (res []*FtpResponse, len int64, err error) {
+	res, len, err = this.downloadTo(ctx, w, remote, 0)
+	return
+}
+
+// OpenReader starts the RETR of remote, the caller must Close the reader to complete the transfer.
+func (this *Ftp) OpenReader(remote string) (res []*FtpResponse, r io.ReadCloser, err error) {
+	return this.OpenReaderContext(context.Background(), remote)
+}
+
+// OpenReaderContext is like OpenReader, the control connection is closed when ctx is done before Close.
+func (this *Ftp) OpenReaderContext(ctx context.Context, remote string) (res []*FtpResponse, r io.ReadCloser, err error) {
+	var dc *ftpDataConn
+	if res, dc, err = this.openDataConn(ctx, fmt.Sprintf("RETR %s", remote), 0); err != nil {
+		return
+	}
+	r = dc
+	return
+}
+
+// OpenWriter starts the STOR of remote, the caller must Close the writer to complete the transfer.
+func (this *Ftp) OpenWriter(remote string) (res []*FtpResponse, w io.WriteCloser, err error) {
+	return this.OpenWriterContext(context.Background(), remote)
+}
+
+// OpenWriterContext is like OpenWriter, the control connection is closed when ctx is done before Close.
+func (this *Ftp) OpenWriterContext(ctx context.Context, remote string) (res []*FtpResponse, w io.WriteCloser, err error) {
+	var dc *ftpDataConn
+	if res, dc, err = this.openDataConn(ctx, fmt.Sprintf("STOR %s", remote), 0); err != nil {
+		return
+	}
+	w = dc
+	return
+}
+
+// ResumeDownload continues the download of remote from the size of the local file.
+func (this *Ftp) ResumeDownload(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.ResumeDownloadContext(context.Background(), local, remote)
+}
+
+func (this *Ftp) ResumeDownloadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	res, len, err = this.resumeDownload(ctx, local, remote)
+	return
+}
+
+// ResumeUpload continues the upload of local from the size of the remote file.
+func (this *Ftp) ResumeUpload(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.ResumeUploadContext(context.Background(), local, remote)
+}
+
+func (this *Ftp) ResumeUploadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	res, len, err = this.resumeUpload(ctx, local, remote)
+	return
+}
+
+// ListEntities lists dir in the structured form, by MLSD if the server supports it.
+func (this *Ftp) ListEntities(dir string) (res []*FtpResponse, ents []*Entity, err error) {
+	return this.ListEntitiesContext(context.Background(), dir)
+}
+
+func (this *Ftp) ListEntitiesContext(ctx context.Context, dir string) (res []*FtpResponse, ents []*Entity, err error) {
+	res, ents, err = this.listEntities(ctx, dir)
+	return
+}
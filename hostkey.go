@@ -0,0 +1,240 @@
+package sftps
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// UnknownHostKeyError is returned when the server is not in the known hosts and its key is not pinned.
+type UnknownHostKeyError struct {
+	Host        string
+	Fingerprint string // SHA256 fingerprint of the key the server presented.
+}
+
+func (this *UnknownHostKeyError) Error() string {
+	return fmt.Sprintf("The host key of %s is unknown (%s).", this.Host, this.Fingerprint)
+}
+
+// HostKeyMismatchError is returned when the server presented a key other than the known one,
+// the connection may be intercepted.
+type HostKeyMismatchError struct {
+	Host        string
+	Fingerprint string   // SHA256 fingerprint of the key the server presented.
+	Want        []string // SHA256 fingerprints of the known keys.
+}
+
+func (this *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("The host key of %s (%s) does not match the known key %s.", this.Host, this.Fingerprint, strings.Join(this.Want, ", "))
+}
+
+// knownHostsMu serializes the appending to the known hosts files by the trust on first use.
+var knownHostsMu sync.Mutex
+
+// hostKeyCallback builds the verification by the parameters, the precedence is
+// HostKeyCallback, HostKeyFingerprints, KnownHosts (or TrustOnFirstUse) and then ~/.ssh/known_hosts.
+// The host certificates are verified by HostCertificateAuthorities before them.
+func (this *SecureFtp) hostKeyCallback() (callback ssh.HostKeyCallback, algorithms []string, err error) {
+	p := this.params
+
+	if p.insecureHostKey {
+		callback = ssh.InsecureIgnoreHostKey()
+		return
+	}
+	if p.hostKeyCallback != nil {
+		callback = p.hostKeyCallback
+		return
+	}
+	if len(p.hostCAs) == 0 {
+		return this.plainHostKeyCallback()
+	}
+
+	var authorities []ssh.PublicKey
+	if authorities, err = readAuthorities(p.hostCAs); err != nil {
+		return
+	}
+	fallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return &UnknownHostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+	}
+	if len(p.fingerprints) > 0 || len(p.knownHosts) > 0 {
+		if fallback, algorithms, err = this.plainHostKeyCallback(); err != nil {
+			return
+		}
+		if len(algorithms) > 0 {
+			algorithms = append(certAlgorithms(algorithms), algorithms...)
+		}
+	}
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			for _, ca := range authorities {
+				if bytes.Equal(ca.Marshal(), auth.Marshal()) {
+					return true
+				}
+			}
+			return false
+		},
+		HostKeyFallback: fallback,
+	}
+	callback = checker.CheckHostKey
+	return
+}
+
+// plainHostKeyCallback builds the verification of the plain host keys.
+func (this *SecureFtp) plainHostKeyCallback() (callback ssh.HostKeyCallback, algorithms []string, err error) {
+	p := this.params
+
+	if len(p.fingerprints) > 0 {
+		callback = fingerprintCallback(p.fingerprints)
+		return
+	}
+
+	files := p.knownHosts
+	if len(files) == 0 {
+		var home string
+		if home, err = os.UserHomeDir(); err != nil {
+			return
+		}
+		files = []string{filepath.Join(home, ".ssh", "known_hosts")}
+	}
+	if p.trustOnFirstUse {
+		var f *os.File
+		if f, err = os.OpenFile(files[0], os.O_CREATE|os.O_RDONLY, 0600); err != nil {
+			return
+		}
+		f.Close()
+	}
+
+	var db ssh.HostKeyCallback
+	if db, err = knownhosts.New(files...); err != nil {
+		return
+	}
+	callback = func(hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+		err = db(hostname, remote, key)
+		var ke *knownhosts.KeyError
+		if !errors.As(err, &ke) {
+			return
+		}
+		if len(ke.Want) == 0 {
+			if p.trustOnFirstUse {
+				return appendKnownHost(files[0], hostname, key)
+			}
+			return &UnknownHostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+		}
+		mismatch := &HostKeyMismatchError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+		for _, k := range ke.Want {
+			mismatch.Want = append(mismatch.Want, ssh.FingerprintSHA256(k.Key))
+		}
+		return mismatch
+	}
+	algorithms = knownAlgorithms(db, net.JoinHostPort(p.host, fmt.Sprint(p.port)))
+	return
+}
+
+// knownAlgorithms returns the types of the known keys for addr, so that the server is asked
+// for one of them instead of its preferred type that may not be known.
+func knownAlgorithms(db ssh.HostKeyCallback, addr string) (algorithms []string) {
+	var ke *knownhosts.KeyError
+	// the probe key never matches, the error tells the known keys.
+	if err := db(addr, &net.TCPAddr{}, probeKey{}); !errors.As(err, &ke) {
+		return
+	}
+	for _, k := range ke.Want {
+		switch k.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, k.Key.Type())
+		}
+	}
+	return
+}
+
+// certAlgorithms returns the certificate types of the key algorithms, so that the server presents
+// its certificate if it has one.
+func certAlgorithms(algorithms []string) (certs []string) {
+	names := map[string]string{
+		ssh.KeyAlgoRSASHA512: ssh.CertAlgoRSASHA512v01,
+		ssh.KeyAlgoRSASHA256: ssh.CertAlgoRSASHA256v01,
+		ssh.KeyAlgoRSA:       ssh.CertAlgoRSAv01,
+		ssh.KeyAlgoECDSA256:  ssh.CertAlgoECDSA256v01,
+		ssh.KeyAlgoECDSA384:  ssh.CertAlgoECDSA384v01,
+		ssh.KeyAlgoECDSA521:  ssh.CertAlgoECDSA521v01,
+		ssh.KeyAlgoED25519:   ssh.CertAlgoED25519v01,
+	}
+	for _, algo := range algorithms {
+		if cert, ok := names[algo]; ok {
+			certs = append(certs, cert)
+		}
+	}
+	return
+}
+
+// readAuthorities reads the CA public keys in the authorized_keys format.
+func readAuthorities(files []string) (keys []ssh.PublicKey, err error) {
+	for _, file := range files {
+		var data []byte
+		if data, err = ioutil.ReadFile(file); err != nil {
+			return
+		}
+		for len(bytes.TrimSpace(data)) > 0 {
+			var key ssh.PublicKey
+			if key, _, _, data, err = ssh.ParseAuthorizedKey(data); err != nil {
+				return
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		err = errors.New("No host certificate authority is found.")
+	}
+	return
+}
+
+type probeKey struct{}
+
+func (probeKey) Type() string {
+	return "probe"
+}
+
+func (probeKey) Marshal() []byte {
+	return []byte("probe")
+}
+
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error {
+	return errors.New("probe key")
+}
+
+func appendKnownHost(file string, hostname string, key ssh.PublicKey) (err error) {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	var f *os.File
+	if f, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	return
+}
+
+// fingerprintCallback accepts the keys whose SHA256 (or legacy MD5) fingerprint is pinned.
+func fingerprintCallback(fingerprints []string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		sha := ssh.FingerprintSHA256(key)
+		md5 := ssh.FingerprintLegacyMD5(key)
+		for _, fp := range fingerprints {
+			if fp == sha || "SHA256:"+fp == sha || strings.TrimPrefix(fp, "MD5:") == md5 {
+				return nil
+			}
+		}
+		return &HostKeyMismatchError{Host: hostname, Fingerprint: sha, Want: fingerprints}
+	}
+}
@@ -0,0 +1,63 @@
+package sftps
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"strings"
+	"testing"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestFingerprintCallback(t *testing.T) {
+	key, other := testHostKey(t), testHostKey(t)
+	sha, md5 := ssh.FingerprintSHA256(key), ssh.FingerprintLegacyMD5(key)
+	otherSha, otherMd5 := ssh.FingerprintSHA256(other), ssh.FingerprintLegacyMD5(other)
+
+	tests := []struct {
+		name         string
+		fingerprints []string
+		match        bool
+	}{
+		{"SHA256:", []string{sha}, true},
+		{"bare SHA256", []string{strings.TrimPrefix(sha, "SHA256:")}, true},
+		{"MD5:", []string{"MD5:" + md5}, true},
+		{"bare MD5", []string{md5}, true},
+		{"one of the fingerprints", []string{otherSha, sha}, true},
+		{"other SHA256:", []string{otherSha}, false},
+		{"other bare SHA256", []string{strings.TrimPrefix(otherSha, "SHA256:")}, false},
+		{"other MD5:", []string{"MD5:" + otherMd5}, false},
+		{"no fingerprint", nil, false},
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	for _, tt := range tests {
+		err := fingerprintCallback(tt.fingerprints)("sftp.example.com:22", addr, key)
+		if tt.match {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var mismatch *HostKeyMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Errorf("%s: got %v, want HostKeyMismatchError", tt.name, err)
+			continue
+		}
+		if mismatch.Host != "sftp.example.com:22" || mismatch.Fingerprint != sha {
+			t.Errorf("%s: got %s %s", tt.name, mismatch.Host, mismatch.Fingerprint)
+		}
+	}
+}
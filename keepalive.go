@@ -0,0 +1,69 @@
+package sftps
+
+import (
+	"context"
+	"time"
+)
+
+// The keepalive flag of the parameters only keeps the session open between the operations (the session reuse),
+// KeepAliveInterval of the parameters keeps the idle session from being closed by the server (the idle keepalive).
+
+// startKeepAlive runs the goroutine that pings the idle session every interval,
+// by NOOP on FTP and by the keepalive@openssh.com request on SFTP.
+func (this *Sftps) startKeepAlive() {
+	if this.keepAliveInterval <= 0 || this.stopKeepAlive != nil {
+		return
+	}
+	// the ping in flight is not cancelled but awaited, the backend would close the connection otherwise.
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	this.stopKeepAlive = func() {
+		close(stop)
+		<-done
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(this.keepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				this.keepAlive(context.Background())
+			}
+		}
+	}()
+}
+
+// keepAlive pings the session unless it was used within the interval or a stream is open on it.
+// The error is not reported, the next operation tells it (and reconnects by the retry policy).
+func (this *Sftps) keepAlive(ctx context.Context) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.state != ONLINE || this.streaming || time.Since(this.lastUsed) < this.keepAliveInterval {
+		return
+	}
+	this.ping(ctx) // bounded by the reply timeout.
+	this.lastUsed = time.Now()
+}
+
+// check pings the session out of the keepalive goroutine, e.g. before the reuse by the Pool.
+func (this *Sftps) check(ctx context.Context) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if err = this.ping(ctx); err == nil {
+		this.lastUsed = time.Now()
+	}
+	return
+}
+
+// endKeepAlive stops the goroutine of startKeepAlive, it must be called without this.mu held.
+func (this *Sftps) endKeepAlive() {
+	if this.stopKeepAlive != nil {
+		this.stopKeepAlive()
+		this.stopKeepAlive = nil
+	}
+}
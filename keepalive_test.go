@@ -0,0 +1,82 @@
+package sftps
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestQuitAwaitsKeepAlive quits while the reply to the NOOP of the keepalive is delayed,
+// the ping in flight must not close the control connection under the QUIT.
+func TestQuitAwaitsKeepAlive(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	noop := make(chan struct{}, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		fmt.Fprintf(c, "220 hi\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch strings.Fields(line)[0] {
+			case "USER":
+				fmt.Fprintf(c, "331 pass\r\n")
+			case "PASS":
+				fmt.Fprintf(c, "230 ok\r\n")
+			case "SYST":
+				fmt.Fprintf(c, "215 UNIX\r\n")
+			case "FEAT":
+				fmt.Fprintf(c, "211 none\r\n")
+			case "NOOP":
+				select {
+				case noop <- struct{}{}:
+				default:
+				}
+				time.Sleep(200 * time.Millisecond)
+				fmt.Fprintf(c, "200 ok\r\n")
+			case "QUIT":
+				fmt.Fprintf(c, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprintf(c, "200 ok\r\n")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	var p int
+	fmt.Sscan(port, &p)
+	param, _ := NewFtpParameters(host, p, "u", "p", true)
+	param.KeepAliveInterval(20 * time.Millisecond)
+	sftps, err := New(FTP, param)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sftps.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-noop:
+	case <-time.After(time.Second):
+		t.Fatal("no keepalive was sent")
+	}
+	if _, err = sftps.Quit(); err != nil {
+		t.Fatalf("quit: %v", err)
+	}
+	if sftps.state != OFFLINE {
+		t.Fatalf("state: %v", sftps.state)
+	}
+}
@@ -0,0 +1,200 @@
+package sftps
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/ssh"
+	"hash"
+	"io/ioutil"
+)
+
+// loadKey reads the private key specified by Keys or KeyData, paired with the certificate if specified.
+func (this *SecureFtp) loadKey() (signer ssh.Signer, err error) {
+	data := this.params.keyData
+	if data == nil {
+		if data, err = ioutil.ReadFile(this.params.privateKey); err != nil {
+			return
+		}
+	}
+	if signer, err = parsePrivateKey(data, this.params.passphrase); err != nil {
+		return
+	}
+
+	if this.params.certificate == "" && this.params.certData == nil {
+		return
+	}
+	data = this.params.certData
+	if data == nil {
+		if data, err = ioutil.ReadFile(this.params.certificate); err != nil {
+			return
+		}
+	}
+	var pub ssh.PublicKey
+	if pub, _, _, _, err = ssh.ParseAuthorizedKey(data); err != nil {
+		return
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		err = errors.New("The certificate file does not contain an SSH certificate.")
+		return
+	}
+	// NewCertSigner fails if the certificate is not of the private key.
+	return ssh.NewCertSigner(cert, signer)
+}
+
+// parsePrivateKey parses the RSA, ECDSA or Ed25519 key in the OpenSSH, PKCS#1, SEC1 or PKCS#8 format.
+// The passphrase decrypts the OpenSSH, the legacy PEM (DEK-Info) and the PKCS#8 (PBES2) encrypted keys,
+// it is ignored if the key is not encrypted.
+func parsePrivateKey(data []byte, passphrase string) (signer ssh.Signer, err error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		err = errors.New("The private key is not in the PEM format.")
+		return
+	}
+
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if passphrase == "" {
+			err = &ssh.PassphraseMissingError{}
+			return
+		}
+		var der []byte
+		if der, err = decryptPKCS8(block.Bytes, []byte(passphrase)); err != nil {
+			return
+		}
+		var key interface{}
+		if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+			err = x509.IncorrectPasswordError
+			return
+		}
+		return ssh.NewSignerFromKey(key)
+	}
+
+	signer, err = ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	return
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts the EncryptedPrivateKeyInfo of PBES2 with PBKDF2 and AES-CBC or 3DES-CBC,
+// which is the format of "openssl pkcs8 -topk8" and "openssl genpkey" with a passphrase.
+func decryptPKCS8(der []byte, passphrase []byte) (plain []byte, err error) {
+	var info encryptedPrivateKeyInfo
+	if _, err = asn1.Unmarshal(der, &info); err != nil {
+		return
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		err = errors.New("The encryption of the PKCS#8 key is not supported, only PBES2 is.")
+		return
+	}
+
+	var params pbes2Params
+	if _, err = asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		err = errors.New("The key derivation of the PKCS#8 key is not supported, only PBKDF2 is.")
+		return
+	}
+	var kdf pbkdf2Params
+	if _, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0 || kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		err = errors.New("The PRF of the PKCS#8 key is not supported.")
+		return
+	}
+
+	var keyLen int
+	var newCipher func(key []byte) (cipher.Block, error)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		err = errors.New("The cipher of the PKCS#8 key is not supported.")
+		return
+	}
+	var iv []byte
+	if _, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return
+	}
+
+	key := pbkdf2.Key(passphrase, kdf.Salt, kdf.IterationCount, keyLen, prf)
+	var block cipher.Block
+	if block, err = newCipher(key); err != nil {
+		return
+	}
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		err = errors.New("The PKCS#8 key is malformed.")
+		return
+	}
+	plain = make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// PKCS#7 padding, a wrong passphrase usually breaks it.
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		err = x509.IncorrectPasswordError
+		return
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			err = x509.IncorrectPasswordError
+			return
+		}
+	}
+	plain = plain[:len(plain)-pad]
+	return
+}
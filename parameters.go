@@ -1,5 +1,12 @@
 package sftps
 
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"time"
+)
 
 type ftpParameters struct {
 	host        string
@@ -8,6 +15,8 @@ type ftpParameters struct {
 	user        string
 	pass        string
 	passive     bool
+	extended    bool
+	listFormat  string
 	keepAlive   bool
 	secure      bool
 	alwaysTrust bool
@@ -15,6 +24,19 @@ type ftpParameters struct {
 	rootCA      string
 	cert        string
 	key         string
+	retryPolicy *RetryPolicy
+	timeouts    Timeouts
+
+	tlsMinVersion uint16
+	tlsMaxVersion uint16
+	serverName    string
+	tlsConfig     *tls.Config
+	pinnedKeys    []string
+	verifyPeer    func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+	clearData     bool
+	clearCommand  bool
+
+	keepAliveInterval time.Duration
 }
 
 type sftpParameters struct {
@@ -24,16 +46,36 @@ type sftpParameters struct {
 	pass          string
 	useKey        bool
 	privateKey    string
+	keyData       []byte
+	certificate   string
+	certData      []byte
 	usePassphrase bool
 	passphrase    string
+	useAgent      bool
+	agentSocket   string
 	keepAlive     bool
+
+	useKeyboardInteractive bool
+	challengeResponder     ssh.KeyboardInteractiveChallenge
+
+	knownHosts      []string
+	trustOnFirstUse bool
+	fingerprints    []string
+	hostKeyCallback ssh.HostKeyCallback
+	insecureHostKey bool
+	hostCAs         []string
+	retryPolicy     *RetryPolicy
+	timeouts        Timeouts
+
+	keepAliveInterval time.Duration
 }
 
-func NewSftpParameters(host string, port int, user string, pass string, keepAlive bool) *sftpParameters {
+func NewSftpParameters(host string, port int, user string, pass string, keepAlive bool) (param *sftpParameters, err error) {
 	if host == "" || user == "" {
-		panic("Invalid parameter were bound.")
+		err = errors.New("Invalid parameter were bound.")
+		return
 	}
-	param := &sftpParameters {
+	param = &sftpParameters {
 		host: host,
 		port: port,
 		user: user,
@@ -44,32 +86,128 @@ func NewSftpParameters(host string, port int, user string, pass string, keepAliv
 		passphrase:  "",
 		keepAlive:  keepAlive,
 	}
-	return param
+	return
 }
 
-func (param *sftpParameters) Keys(privateKey string, usePassphrase bool, passphrase string) {
+// Keys authenticates by the private key file, RSA, ECDSA or Ed25519 in the OpenSSH, PKCS#1, SEC1 or PKCS#8 format.
+func (param *sftpParameters) Keys(privateKey string, usePassphrase bool, passphrase string) (err error) {
+	if usePassphrase && passphrase == "" {
+		err = errors.New("The passphrase must not be empty when specified true to usePassphrase.")
+		return
+	}
 	param.useKey = true
+	param.privateKey = privateKey
+	param.keyData = nil
 	if usePassphrase {
-		if passphrase == "" {
-			panic("The passphrase must not be empty when specified true to usePassphrase.")
-		}
 		param.usePassphrase = true
 		param.passphrase = passphrase
 	}
+	return
+}
+
+// KeyData authenticates by the private key in memory instead of the file specified by Keys.
+// The key is RSA, ECDSA or Ed25519 in the OpenSSH, PKCS#1, SEC1 or PKCS#8 format,
+// passphrase decrypts it if it is encrypted.
+func (param *sftpParameters) KeyData(key []byte, passphrase string) {
+	param.useKey = true
+	param.keyData = key
+	param.usePassphrase = passphrase != ""
+	param.passphrase = passphrase
+}
+
+// Certificate presents the OpenSSH user certificate (the "-cert.pub" file of ssh-keygen -s) for the key
+// specified by Keys or KeyData, instead of the plain public key.
+func (param *sftpParameters) Certificate(file string) {
+	param.certificate = file
+	param.certData = nil
+}
+
+// CertificateData is the same as Certificate with the certificate in memory.
+func (param *sftpParameters) CertificateData(cert []byte) {
+	param.certificate = ""
+	param.certData = cert
 }
 
+// Agent authenticates by the keys of the ssh-agent listening on socket, SSH_AUTH_SOCK is used if socket is empty.
+// The agent keys are offered after the key specified by Keys, and the password is tried last.
+func (param *sftpParameters) Agent(socket string) {
+	param.useAgent = true
+	param.agentSocket = socket
+}
+
+// KeyboardInteractive enables the keyboard-interactive authentication, responder answers the challenges
+// of the server such as the one time password. The password is answered to every hidden prompt if responder is nil.
+// It is tried after the publickey and password, and completes the chain if the server requires several methods.
+func (param *sftpParameters) KeyboardInteractive(responder ssh.KeyboardInteractiveChallenge) {
+	param.useKeyboardInteractive = true
+	param.challengeResponder = responder
+}
+
+// KnownHosts verifies the host key against the OpenSSH known_hosts files,
+// ~/.ssh/known_hosts is used when no other verification is specified.
+func (param *sftpParameters) KnownHosts(files ...string) {
+	param.knownHosts = files
+}
+
+// TrustOnFirstUse accepts the key of a host that is not in the known_hosts file yet and appends it to the file,
+// the known hosts are still verified. The file is created if it does not exist.
+func (param *sftpParameters) TrustOnFirstUse(file string) {
+	param.knownHosts = []string{file}
+	param.trustOnFirstUse = true
+}
+
+// HostKeyFingerprints pins the host key by the fingerprints like "SHA256:..." as ssh-keygen -l shows,
+// it takes precedence over the known_hosts.
+func (param *sftpParameters) HostKeyFingerprints(fingerprints ...string) {
+	param.fingerprints = fingerprints
+}
+
+// HostCertificateAuthorities accepts the host certificates signed by the CA public keys in the files,
+// which are in the authorized_keys format. The principals of the certificate must contain the host.
+// The plain host keys are still verified by HostKeyFingerprints or KnownHosts if specified, rejected otherwise.
+func (param *sftpParameters) HostCertificateAuthorities(files ...string) {
+	param.hostCAs = files
+}
+
+// HostKeyCallback verifies the host key by the callback, it takes precedence over the others.
+func (param *sftpParameters) HostKeyCallback(callback ssh.HostKeyCallback) {
+	param.hostKeyCallback = callback
+}
 
-func NewFtpParameters(host string, port int, user string, pass string, keepalive bool) *ftpParameters {
+// KeepAliveInterval sends the keepalive@openssh.com request every interval while the session is idle,
+// zero disables it. The keepalive of NewSftpParameters only keeps the session open between the operations.
+func (param *sftpParameters) KeepAliveInterval(interval time.Duration) {
+	param.keepAliveInterval = interval
+}
+
+// Retry sets the policy for retrying the operations failed by a transient error, see RetryPolicy.
+func (param *sftpParameters) Retry(policy RetryPolicy) {
+	param.retryPolicy = &policy
+}
+
+// Timeouts sets the bounds of the waits on the connections, see Timeouts.
+func (param *sftpParameters) Timeouts(timeouts Timeouts) {
+	param.timeouts = timeouts
+}
+
+// InsecureIgnoreHostKey accepts any host key, it must not be used other than for testing.
+func (param *sftpParameters) InsecureIgnoreHostKey() {
+	param.insecureHostKey = true
+}
+
+func NewFtpParameters(host string, port int, user string, pass string, keepalive bool) (param *ftpParameters, err error) {
 	if host == "" || user == "" || pass == "" {
-		panic("Invalid parameter were bound.")
+		err = errors.New("Invalid parameter were bound.")
+		return
 	}
-	param := &ftpParameters{
+	param = &ftpParameters{
 		host:        host,
 		port:        port,
 		listenPort:  0,
 		user:        user,
 		pass:        pass,
 		passive:     true,
+		extended:    true,
 		keepAlive:   keepalive,
 		secure:      false,
 		alwaysTrust: false,
@@ -78,22 +216,87 @@ func NewFtpParameters(host string, port int, user string, pass string, keepalive
 		cert:        "",
 		key:         "",
 	}
-	return param
+	return
 }
 func (param *ftpParameters) ActiveMode(actvPort int) {
 	param.passive = false
 	param.listenPort = actvPort
 }
+// Extended specifies whether EPSV and EPRT (RFC 2428) are tried before PASV and PORT, it is enabled by default.
+// IPv6 servers can only be used with the extended commands.
+func (param *ftpParameters) Extended(enable bool) {
+	param.extended = enable
+}
+// ListFormat specifies the name of the parser for the LIST reply (unix, msdos, eplf, vms, netware
+// or the one registered by RegisterListParser), it is detected from the SYST reply by default.
+func (param *ftpParameters) ListFormat(name string) {
+	param.listFormat = name
+}
+// KeepAliveInterval sends NOOP every interval while the control connection is idle, zero disables it.
+// The keepalive of NewFtpParameters only keeps the session open between the operations.
+func (param *ftpParameters) KeepAliveInterval(interval time.Duration) {
+	param.keepAliveInterval = interval
+}
+// Retry sets the policy for retrying the operations failed by a transient error, see RetryPolicy.
+func (param *ftpParameters) Retry(policy RetryPolicy) {
+	param.retryPolicy = &policy
+}
+// Timeouts sets the bounds of the waits on the control and data connections, see Timeouts.
+func (param *ftpParameters) Timeouts(timeouts Timeouts) {
+	param.timeouts = timeouts
+}
 func (param *ftpParameters) Secure(skipVerify bool) {
 	param.secure = true
 	param.alwaysTrust = skipVerify
 }
+// Certs sets the PEM files of the root CA trusted instead of the system roots, and the client certificate and key,
+// each of them may be empty.
 func (param *ftpParameters) Certs(rca string, cert string, key string) {
 	param.secure = true
 	param.rootCA = rca
 	param.cert = cert
 	param.key = key
 }
+// TLSVersion limits the TLS versions, e.g. tls.VersionTLS12 and tls.VersionTLS13.
+// The minimum is TLS 1.2 and the maximum is the latest supported by Go if zero.
+func (param *ftpParameters) TLSVersion(min uint16, max uint16) {
+	param.secure = true
+	param.tlsMinVersion = min
+	param.tlsMaxVersion = max
+}
+// ServerName sets the name sent by SNI and verified against the certificate, the host by default.
+func (param *ftpParameters) ServerName(name string) {
+	param.serverName = name
+}
+// PinnedPublicKeys accepts only the server certificates whose public key has one of the fingerprints,
+// "sha256/" and the base64 of the SHA-256 of the SubjectPublicKeyInfo (see PublicKeyFingerprint), e.g. for the self-signed ones.
+// The chain is not verified then, the pins are checked on the control and every data connection.
+func (param *ftpParameters) PinnedPublicKeys(fingerprints ...string) {
+	param.secure = true
+	param.pinnedKeys = fingerprints
+}
+// VerifyPeerCertificate verifies the server certificates by the callback after the normal verification (or the pinning)
+// on the control and every data connection, the resumed ones too. verifiedChains is nil when the chain is not verified.
+func (param *ftpParameters) VerifyPeerCertificate(callback func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) {
+	param.secure = true
+	param.verifyPeer = callback
+}
+// TLSConfig uses a copy of conf for FTPS, it takes precedence over Secure, Certs and TLSVersion.
+// The ServerName is filled in if empty.
+func (param *ftpParameters) TLSConfig(conf *tls.Config) {
+	param.secure = true
+	param.tlsConfig = conf
+}
+
+// ClearDataChannel transfers the data in the clear by PROT C while the control connection stays encrypted.
+func (param *ftpParameters) ClearDataChannel(enable bool) {
+	param.clearData = enable
+}
+// ClearCommandChannel drops the control connection back to the clear by CCC after the login, for the NAT and
+// the firewalls inspecting the PORT and PASV replies. The password is still sent encrypted.
+func (param *ftpParameters) ClearCommandChannel(enable bool) {
+	param.clearCommand = enable
+}
 
 func (param *ftpParameters) Implicit(port int) {
 	param.secure = true
@@ -0,0 +1,303 @@
+package sftps
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListParser parses a line of the LIST reply. It returns nil without an error
+// if the line is not in its format, so that the other parsers can try it.
+// now is the current time of the client in UTC for resolving the dates without the year.
+type ListParser func(line string, now time.Time) (ent *Entity, err error)
+
+type listParser struct {
+	name  string
+	parse ListParser
+	syst  []string
+}
+
+var (
+	listParsersMu sync.RWMutex
+	listParsers   = []*listParser{
+		{name: "unix", parse: decomposition, syst: []string{"UNIX"}},
+		{name: "msdos", parse: parseMsdosLine, syst: []string{"WINDOWS_NT", "WIN32"}},
+		{name: "eplf", parse: parseEplfLine},
+		{name: "vms", parse: parseVmsLine, syst: []string{"VMS"}},
+		{name: "netware", parse: parseNetwareLine, syst: []string{"NETWARE"}},
+	}
+)
+
+// RegisterListParser adds a parser for the LIST format, or replaces the one of the same name.
+// The new parsers are tried before the built-in ones (unix, msdos, eplf, vms and netware),
+// and first of all when the SYST reply contains one of the syst keywords.
+func RegisterListParser(name string, parser ListParser, syst ...string) {
+	listParsersMu.Lock()
+	defer listParsersMu.Unlock()
+
+	// the keywords are copied, the slice of the caller is left as it is.
+	keys := make([]string, len(syst))
+	for i := range syst {
+		keys[i] = strings.ToUpper(syst[i])
+	}
+	for _, p := range listParsers {
+		if p.name == name {
+			p.parse = parser
+			p.syst = keys
+			return
+		}
+	}
+	listParsers = append([]*listParser{{name: name, parse: parser, syst: keys}}, listParsers...)
+}
+
+// listParserForSyst returns the name of the parser for the SYST reply, empty if unknown.
+func listParserForSyst(system string) (name string) {
+	listParsersMu.RLock()
+	defer listParsersMu.RUnlock()
+
+	system = strings.ToUpper(system)
+	for _, p := range listParsers {
+		for _, key := range p.syst {
+			if strings.Contains(system, key) {
+				return p.name
+			}
+		}
+	}
+	return
+}
+
+// orderedParsers returns a copy of all the parsers with the preferred one first.
+func orderedParsers(prefer string) (parsers []listParser) {
+	listParsersMu.RLock()
+	defer listParsersMu.RUnlock()
+
+	for _, p := range listParsers {
+		if p.name == prefer {
+			parsers = append([]listParser{*p}, parsers...)
+		} else {
+			parsers = append(parsers, *p)
+		}
+	}
+	return
+}
+
+// parseList parses every line of the LIST reply, the lines in no known format are skipped.
+// The parser that matched is tried first for the following lines.
+func parseList(raw string, prefer string) (ents []*Entity, err error) {
+	parsers := orderedParsers(prefer)
+	now := time.Now().UTC()
+
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		for i, p := range parsers {
+			var ent *Entity
+			if ent, err = p.parse(line, now); err != nil {
+				return
+			}
+			if ent != nil {
+				ents = append(ents, ent)
+				if i != 0 {
+					parsers[0], parsers[i] = parsers[i], parsers[0]
+				}
+				break
+			}
+		}
+	}
+	return
+}
+
+var msdosReg = regexp.MustCompile(`^(\d{2}-\d{2}-\d{2,4})\s+(\d{1,2}:\d{2}(?:\s*[AaPp][Mm])?)\s+(<DIR>|\d+)\s+(.+)$`)
+
+// parseMsdosLine parses the MS-DOS format of IIS like "07-09-16  10:30AM       <DIR>          name".
+func parseMsdosLine(line string, now time.Time) (ent *Entity, err error) {
+	cols := msdosReg.FindStringSubmatch(line)
+	if cols == nil {
+		return
+	}
+
+	e := new(Entity)
+	e.Links = 1
+	e.Perms = &Permissions{
+		Type:  "Regular",
+		Owner: &Permission{Read: true, Write: true},
+		Group: new(Permission),
+		Users: new(Permission),
+	}
+	if cols[3] == "<DIR>" {
+		e.Perms.Type = "Directory"
+	} else if e.Size, err = strconv.ParseInt(cols[3], 10, 64); err != nil {
+		return
+	}
+
+	e.LastMod = cols[1] + " " + cols[2]
+	date := "01-02-06"
+	if len(cols[1]) == 10 {
+		date = "01-02-2006"
+	}
+	clock := strings.ToUpper(strings.ReplaceAll(cols[2], " ", ""))
+	layout := "15:04"
+	if strings.HasSuffix(clock, "M") {
+		layout = "3:04PM"
+	}
+	if e.ModTime, err = time.ParseInLocation(date+" "+layout, cols[1]+" "+clock, now.Location()); err != nil {
+		return
+	}
+	e.Name = cols[4]
+	ent = e
+	return
+}
+
+// parseEplfLine parses the Easily Parsed LIST Format like "+i8388621.29609,m824255902,/,\tdev".
+func parseEplfLine(line string, now time.Time) (ent *Entity, err error) {
+	if !strings.HasPrefix(line, "+") {
+		return
+	}
+	facts, name, ok := strings.Cut(line[1:], "\t")
+	if !ok {
+		return
+	}
+
+	e := new(Entity)
+	e.Links = 1
+	e.Name = name
+	e.Perms = &Permissions{Owner: new(Permission), Group: new(Permission), Users: new(Permission)}
+	for _, fact := range strings.Split(facts, ",") {
+		if fact == "" {
+			continue
+		}
+		switch fact[0] {
+		case '/':
+			e.Perms.Type = "Directory"
+		case 'r':
+			e.Perms.Type = "Regular"
+		case 's':
+			if e.Size, err = strconv.ParseInt(fact[1:], 10, 64); err != nil {
+				return
+			}
+		case 'm':
+			var sec int64
+			if sec, err = strconv.ParseInt(fact[1:], 10, 64); err != nil {
+				return
+			}
+			e.ModTime = time.Unix(sec, 0).In(now.Location())
+			e.LastMod = lsTime(e.ModTime)
+		case 'u':
+			if strings.HasPrefix(fact, "up") {
+				var m uint64
+				if m, err = strconv.ParseUint(fact[2:], 8, 32); err != nil {
+					return
+				}
+				tp := e.Perms.Type
+				e.Perms = modeToPermissions(unixModeToFileMode(uint32(m)))
+				e.Perms.Type = tp
+			}
+		}
+	}
+	if e.Perms.Type == "" {
+		e.Perms.Type = "Regular"
+	}
+	ent = e
+	return
+}
+
+var vmsReg = regexp.MustCompile(`^(\S+);(\d+)\s+(\d+)(?:/\d+)?\s+(\d{1,2}-[A-Za-z]{3}-\d{4})\s+(\d{1,2}:\d{2}(?::\d{2})?)\s+\[([^\]]*)\]\s+\(([^)]*)\)`)
+
+// parseVmsLine parses the OpenVMS format like "FILE.TXT;1    2/4    9-JUL-2016 10:30:00  [GROUP,OWNER]  (RWED,RWED,RE,)".
+// The size is the count of the used 512 bytes blocks.
+func parseVmsLine(line string, now time.Time) (ent *Entity, err error) {
+	cols := vmsReg.FindStringSubmatch(line)
+	if cols == nil {
+		return
+	}
+
+	e := new(Entity)
+	e.Links = 1
+	e.Name = cols[1]
+	e.Perms = &Permissions{Type: "Regular"}
+	if strings.HasSuffix(strings.ToUpper(e.Name), ".DIR") {
+		e.Name = e.Name[:len(e.Name)-4]
+		e.Perms.Type = "Directory"
+	}
+
+	var blocks int64
+	if blocks, err = strconv.ParseInt(cols[3], 10, 64); err != nil {
+		return
+	}
+	e.Size = blocks * 512
+
+	e.LastMod = cols[4] + " " + cols[5]
+	layout := "2-Jan-2006 15:04"
+	if strings.Count(cols[5], ":") == 2 {
+		layout += ":05"
+	}
+	if e.ModTime, err = time.ParseInLocation(layout, e.LastMod, now.Location()); err != nil {
+		return
+	}
+
+	if grp, own, ok := strings.Cut(cols[6], ","); ok {
+		e.Group, e.Owner = grp, own
+	} else {
+		e.Owner = cols[6]
+	}
+
+	// (system,owner,group,world)
+	perms := strings.Split(cols[7], ",")
+	for len(perms) < 4 {
+		perms = append(perms, "")
+	}
+	e.Perms.Owner = vmsPermission(perms[1])
+	e.Perms.Group = vmsPermission(perms[2])
+	e.Perms.Users = vmsPermission(perms[3])
+	ent = e
+	return
+}
+
+func vmsPermission(perm string) *Permission {
+	return &Permission{
+		Read:  strings.Contains(perm, "R"),
+		Write: strings.Contains(perm, "W"),
+		Exe:   strings.Contains(perm, "E"),
+	}
+}
+
+var netwareReg = regexp.MustCompile(`^([d\-])\s+\[([RWCEAFMS\-]+)\]\s+(\S+)\s+(\d+)\s+(\S+\s+\d+\s+(?:\d{1,2}:\d{2}|\d{4}))\s+(.+)$`)
+
+// parseNetwareLine parses the NetWare format like "d [RWCEAFMS] owner      512 Jul 09 10:30 name".
+func parseNetwareLine(line string, now time.Time) (ent *Entity, err error) {
+	cols := netwareReg.FindStringSubmatch(line)
+	if cols == nil {
+		return
+	}
+
+	e := new(Entity)
+	e.Links = 1
+	e.Perms = &Permissions{
+		Type: "Regular",
+		Owner: &Permission{
+			Read:  strings.Contains(cols[2], "R"),
+			Write: strings.Contains(cols[2], "W"),
+			Exe:   strings.Contains(cols[2], "E"),
+		},
+		Group: new(Permission),
+		Users: new(Permission),
+	}
+	if cols[1] == "d" {
+		e.Perms.Type = "Directory"
+	}
+	e.Owner = cols[3]
+	if e.Size, err = strconv.ParseInt(cols[4], 10, 64); err != nil {
+		return
+	}
+	e.LastMod = cols[5]
+	if e.ModTime, err = parseLsTime(cols[5], now); err != nil {
+		return
+	}
+	e.Name = cols[6]
+	ent = e
+	return
+}
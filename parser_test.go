@@ -0,0 +1,131 @@
+package sftps
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListParsers(t *testing.T) {
+	now := time.Date(2016, time.August, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		parse   ListParser
+		line    string
+		file    string
+		typ     string
+		size    int64
+		lastMod string
+		modTime time.Time
+	}{
+		{
+			"unix", decomposition,
+			"-rw-r--r--   1 owner group     1234 Jul  9 10:30 file.txt",
+			"file.txt", "Regular", 1234, "Jul  9 10:30", time.Date(2016, time.July, 9, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			"unix year", decomposition,
+			"drwxr-xr-x   2 owner group     4096 Dec 24  2015 dir name",
+			"dir name", "Directory", 4096, "Dec 24  2015", time.Date(2015, time.December, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"msdos 12 hours", parseMsdosLine,
+			"07-09-16  10:30PM       <DIR>          dir",
+			"dir", "Directory", 0, "07-09-16 10:30PM", time.Date(2016, time.July, 9, 22, 30, 0, 0, time.UTC),
+		},
+		{
+			"msdos 24 hours", parseMsdosLine,
+			"07-09-2016  22:30   1234 f.txt",
+			"f.txt", "Regular", 1234, "07-09-2016 22:30", time.Date(2016, time.July, 9, 22, 30, 0, 0, time.UTC),
+		},
+		{
+			"eplf", parseEplfLine,
+			"+i8388621.48594,m825718503,r,s280,\tdjb.html",
+			"djb.html", "Regular", 280, lsTime(time.Unix(825718503, 0).UTC()), time.Unix(825718503, 0).UTC(),
+		},
+		{
+			"vms", parseVmsLine,
+			"SUB.DIR;1    2/4    9-JUL-2016 10:30:00  [GROUP,OWNER]  (RWED,RWED,RE,)",
+			"SUB", "Directory", 1024, "9-JUL-2016 10:30:00", time.Date(2016, time.July, 9, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			"netware", parseNetwareLine,
+			"- [RWCEAFMS] owner      512 Jul 09 10:30 file.txt",
+			"file.txt", "Regular", 512, "Jul 09 10:30", time.Date(2016, time.July, 9, 10, 30, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		ent, err := tt.parse(tt.line, now)
+		if err != nil || ent == nil {
+			t.Errorf("%s: %v, %v", tt.name, ent, err)
+			continue
+		}
+		if ent.Name != tt.file || ent.Perms.Type != tt.typ || ent.Size != tt.size || ent.LastMod != tt.lastMod || !ent.ModTime.Equal(tt.modTime) {
+			t.Errorf("%s: got %q %s %d %q %v", tt.name, ent.Name, ent.Perms.Type, ent.Size, ent.LastMod, ent.ModTime)
+		}
+	}
+}
+
+func TestParseLsTimeLeapDay(t *testing.T) {
+	now := time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+	got, err := parseLsTime("Feb 29 12:30", now)
+	if want := time.Date(2024, time.February, 29, 12, 30, 0, 0, time.UTC); err != nil || !got.Equal(want) {
+		t.Fatalf("got %v, %v, want %v", got, err, want)
+	}
+	got, err = parseLsTime("Oct 17 12:30", now) // within the day of grace.
+	if want := time.Date(2026, time.October, 17, 12, 30, 0, 0, time.UTC); err != nil || !got.Equal(want) {
+		t.Fatalf("got %v, %v, want %v", got, err, want)
+	}
+	got, err = parseLsTime("Dec 24 12:30", now)
+	if want := time.Date(2025, time.December, 24, 12, 30, 0, 0, time.UTC); err != nil || !got.Equal(want) {
+		t.Fatalf("got %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestListParsersSkipOtherFormats(t *testing.T) {
+	now := time.Now().UTC()
+	for _, parse := range []ListParser{decomposition, parseMsdosLine, parseEplfLine, parseVmsLine, parseNetwareLine} {
+		if ent, err := parse("total 42", now); ent != nil || err != nil {
+			t.Errorf("parsed %v, %v", ent, err)
+		}
+	}
+}
+
+func TestParseListDetectsFormat(t *testing.T) {
+	raw := "07-09-16  10:30AM       <DIR>          dir\r\n" +
+		"-rw-r--r--   1 owner group     1234 Jul  9  2016 file.txt\r\n" +
+		"garbage\r\n"
+	ents, err := parseList(raw, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 2 || ents[0].Name != "dir" || ents[1].Name != "file.txt" {
+		t.Fatalf("got %v", ents)
+	}
+}
+
+func TestRegisterListParser(t *testing.T) {
+	syst := []string{"test-os"}
+	RegisterListParser("test", func(line string, now time.Time) (ent *Entity, err error) {
+		if name, ok := strings.CutPrefix(line, "TEST "); ok {
+			ent = &Entity{Name: name, Perms: &Permissions{Type: "Regular"}}
+		}
+		return
+	}, syst...)
+	defer func() {
+		listParsersMu.Lock()
+		listParsers = listParsers[1:]
+		listParsersMu.Unlock()
+	}()
+
+	if name := listParserForSyst("215 TEST-OS system"); name != "test" {
+		t.Fatalf("syst: %q", name)
+	}
+	if syst[0] != "test-os" {
+		t.Fatalf("the keywords of the caller were modified: %q", syst)
+	}
+	ents, err := parseList("TEST a\nTEST b", "test")
+	if err != nil || len(ents) != 2 || ents[1].Name != "b" {
+		t.Fatalf("got %v, %v", ents, err)
+	}
+}
@@ -0,0 +1,242 @@
+package sftps
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Get after the pool was closed.
+var ErrPoolClosed = errors.New("The pool is closed.")
+
+// quitTimeout bounds closing the discarded sessions.
+const quitTimeout = 10 * time.Second
+
+// PoolOptions configures the Pool.
+type PoolOptions struct {
+	MaxConns    int           // the cap of the sessions, to respect the limit of the server per user. 4 if zero.
+	MaxIdle     int           // the idle sessions kept for the reuse, MaxConns if zero.
+	IdleTimeout time.Duration // the idle sessions are closed after this by the next Get or Put, never if zero.
+	CheckAfter  time.Duration // the sessions idle longer than this are checked by NOOP (or the SSH keepalive) before the reuse, always if zero.
+}
+
+// Pool keeps the authenticated sessions to the same server and hands them out per operation,
+// it is safe for the concurrent use while every session is used by one goroutine at a time.
+// When the server refuses a new session by 421 (too many connections), the cap is lowered
+// to the sessions open and Get waits for one of them.
+type Pool struct {
+	proto  int
+	param  interface{}
+	opts   PoolOptions
+	mu     sync.Mutex
+	idle   []*pooledSession
+	open   int
+	limit  int
+	wake   chan struct{}
+	closed bool
+}
+
+type pooledSession struct {
+	sftps *Sftps
+	used  time.Time
+}
+
+// NewPool creates the pool of the sessions by the parameters of New, the sessions are connected on demand.
+func NewPool(proto int, param interface{}, opts PoolOptions) (pool *Pool, err error) {
+	if _, err = New(proto, param); err != nil {
+		return
+	}
+	if opts.MaxConns <= 0 {
+		opts.MaxConns = 4
+	}
+	if opts.MaxIdle <= 0 || opts.MaxIdle > opts.MaxConns {
+		opts.MaxIdle = opts.MaxConns
+	}
+	pool = &Pool{
+		proto: proto,
+		param: param,
+		opts:  opts,
+		limit: opts.MaxConns,
+		wake:  make(chan struct{}),
+	}
+	return
+}
+
+// Get returns a connected session, an idle one if any. It waits until ctx is done when every session is in use.
+// The session must be returned by Put, it is kept alive until then regardless of the parameters.
+func (this *Pool) Get(ctx context.Context) (sftps *Sftps, err error) {
+	for {
+		this.mu.Lock()
+		if this.closed {
+			this.mu.Unlock()
+			err = ErrPoolClosed
+			return
+		}
+		if expired := this.expired(); len(expired) > 0 {
+			this.mu.Unlock()
+			this.discardAll(expired)
+			continue
+		}
+
+		if n := len(this.idle); n > 0 {
+			// the most recently used one is the most likely alive.
+			ps := this.idle[n-1]
+			this.idle = this.idle[:n-1]
+			this.mu.Unlock()
+			if this.healthy(ctx, ps) {
+				sftps = ps.sftps
+				return
+			}
+			this.discard(ps.sftps)
+			continue
+		}
+
+		if this.open < this.limit {
+			this.open++
+			this.mu.Unlock()
+			if sftps, err = this.dial(ctx); err == nil {
+				return
+			}
+			this.mu.Lock()
+			this.open--
+			var pe *ProtocolError
+			tooMany := errors.As(err, &pe) && pe.Code == 421 && this.open > 0
+			if tooMany {
+				this.limit = this.open
+			}
+			this.signal()
+			this.mu.Unlock()
+			if !tooMany {
+				return
+			}
+			err = nil
+			continue
+		}
+
+		wake := this.wake
+		this.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-wake:
+		}
+	}
+}
+
+// Put returns the session to the pool, err is the result of the last operation.
+// The session is closed instead of being reused if it was lost or the pool is full.
+func (this *Pool) Put(sftps *Sftps, err error) {
+	this.mu.Lock()
+	if this.closed || sftps.state == OFFLINE || (err != nil && connectionLost(err)) || len(this.idle) >= this.opts.MaxIdle {
+		this.mu.Unlock()
+		this.discard(sftps)
+		return
+	}
+	this.idle = append(this.idle, &pooledSession{sftps: sftps, used: time.Now()})
+	expired := this.expired()
+	this.signal()
+	this.mu.Unlock()
+	this.discardAll(expired)
+}
+
+// expired takes the sessions idle longer than IdleTimeout out of the idle ones, this.mu must be held.
+// The idle ones are in the order of the return, the oldest first.
+func (this *Pool) expired() (expired []*pooledSession) {
+	if this.opts.IdleTimeout <= 0 {
+		return
+	}
+	n := 0
+	for n < len(this.idle) && time.Since(this.idle[n].used) > this.opts.IdleTimeout {
+		n++
+	}
+	expired = append(expired, this.idle[:n]...)
+	this.idle = append(this.idle[:0], this.idle[n:]...)
+	return
+}
+
+func (this *Pool) discardAll(sessions []*pooledSession) {
+	for _, ps := range sessions {
+		this.discard(ps.sftps)
+	}
+}
+
+// Do runs op with a session of the pool and returns it to the pool.
+func (this *Pool) Do(ctx context.Context, op func(sftps *Sftps) error) (err error) {
+	var sftps *Sftps
+	if sftps, err = this.Get(ctx); err != nil {
+		return
+	}
+	err = op(sftps)
+	this.Put(sftps, err)
+	return
+}
+
+// Close closes the idle sessions, the ones in use are closed when they are returned.
+func (this *Pool) Close() (err error) {
+	this.mu.Lock()
+	idle := this.idle
+	this.idle = nil
+	this.closed = true
+	this.signal()
+	this.mu.Unlock()
+
+	for _, ps := range idle {
+		this.mu.Lock()
+		this.open--
+		this.mu.Unlock()
+		if e := quitQuietly(ps.sftps); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// quitQuietly closes the session within quitTimeout, the server may not answer any longer.
+func quitQuietly(sftps *Sftps) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), quitTimeout)
+	defer cancel()
+	_, err = sftps.QuitContext(ctx)
+	return
+}
+
+func (this *Pool) dial(ctx context.Context) (sftps *Sftps, err error) {
+	if sftps, err = New(this.proto, this.param); err != nil {
+		return
+	}
+	sftps.keepalive = true
+	if _, err = sftps.ConnectContext(ctx); err != nil {
+		sftps = nil
+	}
+	return
+}
+
+// healthy checks the idle session before the reuse.
+func (this *Pool) healthy(ctx context.Context, ps *pooledSession) bool {
+	idle := time.Since(ps.used)
+	if this.opts.IdleTimeout > 0 && idle > this.opts.IdleTimeout {
+		return false
+	}
+	if idle < this.opts.CheckAfter {
+		return true
+	}
+	return ps.sftps.check(ctx) == nil
+}
+
+// discard closes the session and frees its slot.
+func (this *Pool) discard(sftps *Sftps) {
+	if sftps.state == ONLINE {
+		quitQuietly(sftps)
+	}
+	this.mu.Lock()
+	this.open--
+	this.signal()
+	this.mu.Unlock()
+}
+
+// signal wakes the waiters of Get up, this.mu must be held.
+func (this *Pool) signal() {
+	close(this.wake)
+	this.wake = make(chan struct{})
+}
@@ -0,0 +1,169 @@
+package sftps
+
+import (
+	"context"
+	"errors"
+	"github.com/pkg/sftp"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries the operations of Sftps failed by a transient error, the session is
+// connected and authenticated again first if the connection was lost.
+// The interrupted Download and Upload are resumed, the streaming operations are retried
+// only if nothing was transferred yet.
+type RetryPolicy struct {
+	MaxAttempts    int                  // the attempts including the first one, 1 or less disables the retry.
+	InitialBackoff time.Duration        // the wait before the first retry, 1s if zero.
+	MaxBackoff     time.Duration        // the upper bound of the wait, 30s if zero.
+	Multiplier     float64              // the growth of the wait per retry, 2 if zero.
+	Jitter         float64              // the random fraction (0 to 1) of the wait that is subtracted.
+	Retryable      func(err error) bool // DefaultRetryable is used if nil.
+}
+
+// backoff returns the wait before the retry following attempt.
+func (this *RetryPolicy) backoff(attempt int) time.Duration {
+	initial, max, mul := this.InitialBackoff, this.MaxBackoff, this.Multiplier
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if mul <= 0 {
+		mul = 2
+	}
+	d := math.Min(float64(initial)*math.Pow(mul, float64(attempt-1)), float64(max))
+	if this.Jitter > 0 {
+		d -= d * math.Min(this.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+func (this *RetryPolicy) retryable(err error) bool {
+	if this.Retryable != nil {
+		return this.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// DefaultRetryable reports whether err is transient, that is a 4xx reply of the FTP server or a lost connection.
+// The cancellation of the context, the authentication failures and the other replies are not.
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrAuthFailed) {
+		return false
+	}
+	var pe *ProtocolError
+	if errors.As(err, &pe) {
+		return pe.Transient()
+	}
+	return connectionLost(err)
+}
+
+// connectionLost reports whether the connection cannot be used any longer after err.
+func connectionLost(err error) bool {
+	var pe *ProtocolError
+	if errors.As(err, &pe) {
+		return pe.Code == 421 // the server is closing the control connection.
+	}
+	var ne net.Error
+	return errors.As(err, &ne) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, sftp.ErrSSHFxNoConnection)
+}
+
+// reconnector is implemented by the backends that can restore their session state on the new connection.
+type reconnector interface {
+	ReconnectContext(ctx context.Context) (res []*FtpResponse, err error)
+}
+
+// finalError stops the retry of the operation, e.g. when the data was already partially transferred.
+type finalError struct {
+	err error
+}
+
+func (this *finalError) Error() string {
+	return this.err.Error()
+}
+
+func (this *finalError) Unwrap() error {
+	return this.err
+}
+
+// countingReader counts the bytes read from the stream, which are gone even if they never reached the server.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (this *countingReader) Read(p []byte) (n int, err error) {
+	n, err = this.Reader.Read(p)
+	this.n += int64(n)
+	return
+}
+
+// retry runs op by the retry policy, attempt starts from 1. Every operation of Sftps runs through it.
+func (this *Sftps) retry(ctx context.Context, op func(attempt int) error) (err error) {
+	this.mu.Lock()
+	defer func() {
+		this.lastUsed = time.Now()
+		this.mu.Unlock()
+	}()
+
+	lost := false
+	for attempt := 1; ; attempt++ {
+		err = nil
+		if lost {
+			err = this.reconnect(ctx)
+		}
+		if err == nil {
+			err = op(attempt)
+		}
+		if err == nil {
+			return
+		}
+
+		var fe *finalError
+		if errors.As(err, &fe) {
+			err = fe.err
+			return
+		}
+		p := this.retryPolicy
+		if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(err) {
+			return
+		}
+		lost = connectionLost(err)
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// reconnect connects the session again after the connection was lost.
+func (this *Sftps) reconnect(ctx context.Context) (err error) {
+	this.state = OFFLINE
+	if r, ok := this.client.(reconnector); ok {
+		_, err = r.ReconnectContext(ctx)
+	} else {
+		this.client.QuitContext(ctx)
+		_, err = this.client.ConnectContext(ctx)
+	}
+	if err == nil {
+		this.state = ONLINE
+	}
+	return
+}
@@ -1,23 +1,26 @@
 package sftps
 
 import (
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/pem"
-	"fmt"
+	"context"
+	"errors"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 	"io"
-	"io/ioutil"
 	"net"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type SecureFtp struct {
-	sshClient  *ssh.Client
-	sftpClient *sftp.Client
-	params     *sftpParameters
-	state      int
+	sshClient   *ssh.Client
+	sftpClient  *sftp.Client
+	params      *sftpParameters
+	state       int
+	interrupted atomic.Bool // the session was torn down by a cancelled context.
 }
 
 func newSftp(p *sftpParameters) (sftp *SecureFtp) {
@@ -26,163 +29,261 @@ func newSftp(p *sftpParameters) (sftp *SecureFtp) {
 	return
 }
 
-func (this *SecureFtp) connect() (err error) {
-	var pemBytes []byte
-	var pemBlock []byte
-	var signer ssh.Signer
-	var ip []net.IP
-
+func (this *SecureFtp) connect(ctx context.Context) (err error) {
+	if this.sshClient != nil {
+		this.sshClient.Close() // left by the session failed before.
+	}
 	config := &ssh.ClientConfig{
 		User: this.params.user,
 	}
+	if config.HostKeyCallback, config.HostKeyAlgorithms, err = this.hostKeyCallback(); err != nil {
+		return
+	}
 
-	if this.params.useKey {
-		if pemBytes, err = ioutil.ReadFile(this.params.privateKey); err != nil {
-			return
-		}
-
-		if this.params.usePassphrase {
-			passphraseBytes := []byte(this.params.passphrase)
-			block, _ := pem.Decode(pemBytes)
-			if pemBlock, err = x509.DecryptPEMBlock(block, passphraseBytes); err != nil {
-				return
-			}
-			keyString := base64.StdEncoding.EncodeToString(pemBlock)
-			key := fmt.Sprintf("-----BEGIN %s-----\n%s\n-----END %s-----\n", block.Type, keyString, block.Type)
-			if signer, err = ssh.ParsePrivateKey([]byte(key)); err != nil {
-				return
-			}
-		} else {
-			if signer, err = ssh.ParsePrivateKey(pemBytes); err != nil {
-				return
-			}
+	var conn net.Conn
+	timeouts := this.params.timeouts
+	// the handshake timeout is lifted while the user answers the keyboard-interactive challenge, e.g. an OTP.
+	interactive := func(responder ssh.KeyboardInteractiveChallenge) ssh.KeyboardInteractiveChallenge {
+		return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			extend(ctx, conn, 0)
+			defer extend(ctx, conn, timeouts.handshake())
+			return responder(name, instruction, questions, echos)
 		}
-		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
 	}
-
-	if this.params.pass != "" {
-		config.Auth = append(config.Auth, ssh.Password(this.params.pass))
+	var closeAgent func()
+	if config.Auth, closeAgent, err = this.authMethods(interactive); err != nil {
+		return
 	}
+	defer closeAgent()
 
 	config.SetDefaults()
-	if ip, err = net.LookupIP(this.params.host); err != nil {
+	// the dialer tries every address of the host, IPv6 and IPv4 alike.
+	addr := net.JoinHostPort(this.params.host, strconv.Itoa(this.params.port))
+
+	if conn, err = timeouts.dialer(timeouts.dial()).DialContext(ctx, "tcp", addr); err != nil {
 		return
 	}
-	addr := fmt.Sprintf("%s:%d", ip[0], this.params.port)
-
-	if this.sshClient, err = ssh.Dial("tcp", addr, config); err != nil {
+	var c ssh.Conn
+	var chans <-chan ssh.NewChannel
+	var reqs <-chan *ssh.Request
+	release := watch(ctx, conn, timeouts.handshake())
+	defer release()
+	if c, chans, reqs, err = ssh.NewClientConn(conn, addr, config); err != nil {
+		conn.Close()
+		err = sftpError(ctxError(ctx, err))
 		return
 	}
+	this.sshClient = ssh.NewClient(c, chans, reqs)
+	this.interrupted.Store(false)
+	// the sftp subsystem and its version exchange, the server may never answer either.
+	extend(ctx, conn, timeouts.handshake())
 	if this.sftpClient, err = sftp.NewClient(this.sshClient); err != nil {
-		if e := this.sshClient.Close(); e != nil {
-			panic(e)
-		}
+		this.sshClient.Close()
+		err = ctxError(ctx, err)
 	}
 	return
 }
 
-func (this *SecureFtp) list(p string) (list string, err error) {
-	var session *ssh.Session
-	if session, err = this.sshClient.NewSession(); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
+// list renders the entries of p in the format of "ls -l", it is kept for the compatibility,
+// use listEntities for the structured form.
+func (this *SecureFtp) list(p string, touch func()) (list string, err error) {
+	var ents []*Entity
+	if ents, err = this.listEntities(p, touch); err != nil {
+		return
 	}
-	defer session.Close()
+	lines := make([]string, 0, len(ents))
+	for _, ent := range ents {
+		lines = append(lines, entityToString(ent))
+	}
+	list = strings.Join(lines, "\n")
+	return
+}
 
-	cmd := fmt.Sprintf("ls -al %s", p)
-	var bytes []byte
-	if bytes, err = session.Output(cmd); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
+// listEntities reads the directory by the SFTP protocol, no shell is required on the server.
+// touch is called after each request, the reading of the directory and the reading of each link.
+func (this *SecureFtp) listEntities(p string, touch func()) (ents []*Entity, err error) {
+	var fis []os.FileInfo
+	if fis, err = this.sftpClient.ReadDir(p); err != nil {
+		err = sftpError(err)
+		return
+	}
+	touch()
+	for _, fi := range fis {
+		ent := sftpEntity(fi)
+		if fi.Mode()&os.ModeSymlink != 0 {
+			ent.LinkTarget, _ = this.sftpClient.ReadLink(path.Join(p, fi.Name()))
+			touch()
 		}
+		ents = append(ents, ent)
 	}
-	list = string(bytes)
 	return
 }
 
-func (this *SecureFtp) download(local string, remote string) (len int64, err error) {
-	var r io.Reader
-	var w io.Writer
+func (this *SecureFtp) download(local string, remote string, touch func()) (len int64, err error) {
+	var f *os.File
+	if f, err = os.Create(local); err != nil {
+		return
+	}
+	defer f.Close()
+
+	len, err = this.downloadTo(f, remote, touch)
+	return
+}
+
+func (this *SecureFtp) downloadTo(w io.Writer, remote string, touch func()) (len int64, err error) {
+	var r *sftp.File
 
 	if r, err = this.sftpClient.Open(remote); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
+		err = sftpError(err)
+		return
 	}
-	if w, err = os.Create(local); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
+	defer r.Close()
+
+	len, err = io.Copy(touchWriter{w, touch}, r)
+	return
+}
+
+func (this *SecureFtp) upload(local string, remote string, touch func()) (len int64, err error) {
+	var f *os.File
+	if f, err = os.Open(local); err != nil {
+		return
 	}
-	if len, err = io.Copy(w, r); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
+	defer f.Close()
+
+	len, err = this.uploadFrom(f, remote, touch)
+	return
+}
+
+func (this *SecureFtp) uploadFrom(r io.Reader, remote string, touch func()) (len int64, err error) {
+	var w *sftp.File
+
+	if w, err = this.sftpClient.Create(remote); err != nil {
+		err = sftpError(err)
+		return
+	}
+
+	if len, err = io.Copy(w, touchReader{r, touch}); err != nil {
+		w.Close()
+		return
 	}
+	err = w.Close()
 	return
 }
 
-func (this *SecureFtp) upload(local string, remote string) (len int64, err error) {
-	var r io.Reader
-	var w io.Writer
+// resumeDownload continues the download from the end of the local file by the offset read.
+func (this *SecureFtp) resumeDownload(local string, remote string, touch func()) (len int64, err error) {
+	var f *os.File
+	var r *sftp.File
+	var fi os.FileInfo
+	var offset int64
 
-	if r, err = os.Open(local); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
+	if f, err = os.OpenFile(local, os.O_WRONLY|os.O_CREATE, 0666); err != nil {
+		return
 	}
-	if w, err = this.sftpClient.Create(remote); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
+	defer f.Close()
+	if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+		return
 	}
-	if len, err = io.Copy(w, r); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
+
+	if r, err = this.sftpClient.Open(remote); err != nil {
+		err = sftpError(err)
+		return
+	}
+	defer r.Close()
+	if fi, err = r.Stat(); err != nil {
+		return
+	}
+	if offset == fi.Size() {
+		return
+	}
+	if offset > fi.Size() {
+		err = errors.New("The local file is larger than the remote file, could not resume the download.")
+		return
+	}
+	if _, err = r.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+	len, err = io.Copy(touchWriter{f, touch}, r)
+	return
+}
+
+// resumeUpload continues the upload from the end of the remote file by the offset write.
+func (this *SecureFtp) resumeUpload(local string, remote string, touch func()) (len int64, err error) {
+	var f *os.File
+	var w *sftp.File
+	var fi, rfi os.FileInfo
+	var offset int64
+
+	if f, err = os.Open(local); err != nil {
+		return
+	}
+	defer f.Close()
+	if fi, err = f.Stat(); err != nil {
+		return
 	}
 
+	if w, err = this.sftpClient.OpenFile(remote, os.O_WRONLY|os.O_CREATE); err != nil {
+		err = sftpError(err)
+		return
+	}
+	if rfi, err = w.Stat(); err != nil {
+		w.Close()
+		return
+	}
+	offset = rfi.Size()
+	if offset == fi.Size() {
+		err = w.Close()
+		return
+	}
+	if offset > fi.Size() {
+		w.Close()
+		err = errors.New("The remote file is larger than the local file, could not resume the upload.")
+		return
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		w.Close()
+		return
+	}
+	if _, err = w.Seek(offset, io.SeekStart); err != nil {
+		w.Close()
+		return
+	}
+	if len, err = io.Copy(w, touchReader{f, touch}); err != nil {
+		w.Close()
+		return
+	}
+	err = w.Close()
 	return
 }
 
 func (this *SecureFtp) mkdir(p string) (err error) {
-	if err = this.sftpClient.Mkdir(p); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
-	}
+	err = sftpError(this.sftpClient.Mkdir(p))
 	return
 }
 
 func (this *SecureFtp) remove(p string) (err error) {
-	if err = this.sftpClient.Remove(p); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
-	}
+	err = sftpError(this.sftpClient.Remove(p))
 	return
 }
 
 func (this *SecureFtp) rename(old, new string) (err error) {
-	if err = this.sftpClient.Rename(old, new); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
-	}
+	err = sftpError(this.sftpClient.Rename(old, new))
 	return
 }
 
 func (this *SecureFtp) symlink(dest, src string) (err error) {
-	if err = this.sftpClient.Symlink(src, dest); err != nil {
-		if e := this.quit(); e != nil {
-			panic(e)
-		}
-	}
+	err = sftpError(this.sftpClient.Symlink(src, dest))
 	return
 }
 
 func (this *SecureFtp) quit() (err error) {
+	if this.sshClient == nil {
+		err = ErrNotConnected
+		return
+	}
+	if this.interrupted.Load() {
+		return
+	}
 	if err = this.sftpClient.Close(); err != nil {
 		return
 	}
@@ -191,3 +292,406 @@ func (this *SecureFtp) quit() (err error) {
 	}
 	return
 }
+
+func (this *SecureFtp) stat(p string) (ent *Entity, err error) {
+	var fi os.FileInfo
+	if fi, err = this.sftpClient.Lstat(p); err != nil {
+		err = sftpError(err)
+		return
+	}
+	ent = sftpEntity(fi)
+	if fi.Mode()&os.ModeSymlink != 0 {
+		ent.LinkTarget, _ = this.sftpClient.ReadLink(p)
+	}
+	return
+}
+
+// sftpEntity converts fi with the numeric owner and group of the SFTP attributes.
+func sftpEntity(fi os.FileInfo) (ent *Entity) {
+	ent = fileInfoToEntity(fi)
+	if st, ok := fi.Sys().(*sftp.FileStat); ok {
+		ent.Owner = strconv.FormatUint(uint64(st.UID), 10)
+		ent.Group = strconv.FormatUint(uint64(st.GID), 10)
+	}
+	return
+}
+
+// interruptible runs op and tears the session down if ctx is done or the reply timeout passed before op returned,
+// the SFTP requests in flight cannot be cancelled one by one.
+func (this *SecureFtp) interruptible(ctx context.Context, op func() error) (err error) {
+	return this.bounded(ctx, this.params.timeouts.reply(), func(func()) error {
+		return op()
+	})
+}
+
+// requests is like interruptible for op sending several requests, the reply timeout is restarted by touch after each of them.
+func (this *SecureFtp) requests(ctx context.Context, op func(touch func()) error) (err error) {
+	return this.bounded(ctx, this.params.timeouts.reply(), op)
+}
+
+// transfer is like interruptible, but the data idle timeout is restarted by touch on every progress of op.
+func (this *SecureFtp) transfer(ctx context.Context, op func(touch func()) error) (err error) {
+	return this.bounded(ctx, this.params.timeouts.dataIdle(), op)
+}
+
+func (this *SecureFtp) bounded(ctx context.Context, timeout time.Duration, op func(touch func()) error) (err error) {
+	if this.sftpClient == nil {
+		err = ErrNotConnected
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	touch := func() {}
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			cancel(os.ErrDeadlineExceeded)
+		})
+		defer timer.Stop()
+		touch = func() {
+			timer.Reset(timeout)
+		}
+	}
+	stop := context.AfterFunc(ctx, this.interrupt)
+	err = op(touch)
+	if !stop() {
+		err = context.Cause(ctx)
+	}
+	return
+}
+
+// Features returns the SFTP extensions the server advertised, nil if not connected.
+func (this *SecureFtp) Features() (features Features) {
+	if this.sftpClient == nil {
+		return
+	}
+	features = Features{}
+	for _, name := range sftpExtensions {
+		if data, ok := this.sftpClient.HasExtension(name); ok {
+			features[strings.ToUpper(name)] = data
+		}
+	}
+	return
+}
+
+// ping checks the connection by the keepalive request of OpenSSH, any reply tells it is alive.
+func (this *SecureFtp) ping(ctx context.Context) (err error) {
+	err = this.interruptible(ctx, func() (e error) {
+		_, _, e = this.sshClient.SendRequest("keepalive@openssh.com", true, nil)
+		return
+	})
+	return
+}
+
+func (this *SecureFtp) interrupt() {
+	this.interrupted.Store(true)
+	this.state = OFFLINE
+	this.sshClient.Close()
+}
+
+func (this *SecureFtp) Connect() (res []*FtpResponse, err error) {
+	return this.ConnectContext(context.Background())
+}
+
+func (this *SecureFtp) ConnectContext(ctx context.Context) (res []*FtpResponse, err error) {
+	if err = this.connect(ctx); err != nil {
+		return
+	}
+	this.state = ONLINE
+	return
+}
+
+// Reconnect closes the connection, connects and authenticates again.
+func (this *SecureFtp) Reconnect() (res []*FtpResponse, err error) {
+	return this.ReconnectContext(context.Background())
+}
+
+func (this *SecureFtp) ReconnectContext(ctx context.Context) (res []*FtpResponse, err error) {
+	if this.sshClient != nil {
+		this.sshClient.Close()
+	}
+	this.state = OFFLINE
+	return this.ConnectContext(ctx)
+}
+
+func (this *SecureFtp) Quit() (res *FtpResponse, err error) {
+	return this.QuitContext(context.Background())
+}
+
+func (this *SecureFtp) QuitContext(ctx context.Context) (res *FtpResponse, err error) {
+	err = this.quit()
+	this.state = OFFLINE
+	return
+}
+
+func (this *SecureFtp) List(p string) (res []*FtpResponse, list string, err error) {
+	return this.ListContext(context.Background(), p)
+}
+
+func (this *SecureFtp) ListContext(ctx context.Context, p string) (res []*FtpResponse, list string, err error) {
+	err = this.requests(ctx, func(touch func()) (e error) {
+		list, e = this.list(p, touch)
+		return
+	})
+	return
+}
+
+func (this *SecureFtp) Mkdir(p string) (res []*FtpResponse, err error) {
+	return this.MkdirContext(context.Background(), p)
+}
+
+func (this *SecureFtp) MkdirContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	err = this.interruptible(ctx, func() error {
+		return this.mkdir(p)
+	})
+	return
+}
+
+func (this *SecureFtp) Rmdir(p string) (res []*FtpResponse, err error) {
+	return this.RmdirContext(context.Background(), p)
+}
+
+func (this *SecureFtp) RmdirContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	err = this.interruptible(ctx, func() error {
+		return this.remove(p)
+	})
+	return
+}
+
+func (this *SecureFtp) Rename(old string, new string) (res []*FtpResponse, err error) {
+	return this.RenameContext(context.Background(), old, new)
+}
+
+func (this *SecureFtp) RenameContext(ctx context.Context, old string, new string) (res []*FtpResponse, err error) {
+	err = this.interruptible(ctx, func() error {
+		return this.rename(old, new)
+	})
+	return
+}
+
+func (this *SecureFtp) Upload(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.UploadContext(context.Background(), local, remote)
+}
+
+func (this *SecureFtp) UploadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	err = this.transfer(ctx, func(touch func()) (e error) {
+		len, e = this.upload(local, remote, touch)
+		return
+	})
+	return
+}
+
+func (this *SecureFtp) Download(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.DownloadContext(context.Background(), local, remote)
+}
+
+func (this *SecureFtp) DownloadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	err = this.transfer(ctx, func(touch func()) (e error) {
+		len, e = this.download(local, remote, touch)
+		return
+	})
+	return
+}
+
+func (this *SecureFtp) Stat(p string) (res []*FtpResponse, ent *Entity, err error) {
+	return this.StatContext(context.Background(), p)
+}
+
+func (this *SecureFtp) StatContext(ctx context.Context, p string) (res []*FtpResponse, ent *Entity, err error) {
+	err = this.interruptible(ctx, func() (e error) {
+		ent, e = this.stat(p)
+		return
+	})
+	return
+}
+
+func (this *SecureFtp) Remove(p string) (res []*FtpResponse, err error) {
+	return this.RemoveContext(context.Background(), p)
+}
+
+func (this *SecureFtp) RemoveContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	err = this.interruptible(ctx, func() error {
+		return this.remove(p)
+	})
+	return
+}
+
+func (this *SecureFtp) UploadFrom(r io.Reader, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.UploadFromContext(context.Background(), r, remote)
+}
+
+func (this *SecureFtp) UploadFromContext(ctx context.Context, r io.Reader, remote string) (res []*FtpResponse, len int64, err error) {
+	err = this.transfer(ctx, func(touch func()) (e error) {
+		len, e = this.uploadFrom(r, remote, touch)
+		return
+	})
+	return
+}
+
+func (this *SecureFtp) DownloadTo(w io.Writer, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.DownloadToContext(context.Background(), w, remote)
+}
+
+func (this *SecureFtp) DownloadToContext(ctx context.Context, w io.Writer, remote string) (res []*FtpResponse, len int64, err error) {
+	err = this.transfer(ctx, func(touch func()) (e error) {
+		len, e = this.downloadTo(w, remote, touch)
+		return
+	})
+	return
+}
+
+func (this *SecureFtp) OpenReader(remote string) (res []*FtpResponse, r io.ReadCloser, err error) {
+	return this.OpenReaderContext(context.Background(), remote)
+}
+
+// OpenReaderContext is like OpenReader, the session is torn down when ctx is done before Close.
+func (this *SecureFtp) OpenReaderContext(ctx context.Context, remote string) (res []*FtpResponse, r io.ReadCloser, err error) {
+	var f *sftp.File
+	if err = this.interruptible(ctx, func() (e error) {
+		f, e = this.sftpClient.Open(remote)
+		e = sftpError(e)
+		return
+	}); err != nil {
+		return
+	}
+	r = this.newStream(ctx, f)
+	return
+}
+
+func (this *SecureFtp) OpenWriter(remote string) (res []*FtpResponse, w io.WriteCloser, err error) {
+	return this.OpenWriterContext(context.Background(), remote)
+}
+
+// OpenWriterContext is like OpenWriter, the session is torn down when ctx is done before Close.
+func (this *SecureFtp) OpenWriterContext(ctx context.Context, remote string) (res []*FtpResponse, w io.WriteCloser, err error) {
+	var f *sftp.File
+	if err = this.interruptible(ctx, func() (e error) {
+		f, e = this.sftpClient.Create(remote)
+		e = sftpError(e)
+		return
+	}); err != nil {
+		return
+	}
+	w = this.newStream(ctx, f)
+	return
+}
+
+// sftpStream is a remote file opened for streaming.
+type sftpStream struct {
+	*sftp.File
+	ctx     context.Context
+	stop    func() bool
+	idle    *time.Timer // tears the session down when no byte was transferred for timeout, nil if disabled.
+	timeout time.Duration
+	expired atomic.Bool
+}
+
+func (this *SecureFtp) newStream(ctx context.Context, f *sftp.File) (s *sftpStream) {
+	s = &sftpStream{File: f, stop: context.AfterFunc(ctx, this.interrupt), ctx: ctx}
+	if s.timeout = this.params.timeouts.dataIdle(); s.timeout > 0 {
+		s.idle = time.AfterFunc(s.timeout, func() {
+			s.expired.Store(true)
+			this.interrupt()
+		})
+	}
+	return
+}
+
+// touch restarts the idle timeout on the progress.
+func (this *sftpStream) touch() {
+	if this.idle != nil && !this.expired.Load() {
+		this.idle.Reset(this.timeout)
+	}
+}
+
+// result prefers the idle timeout over the error of the torn down session.
+func (this *sftpStream) result(n int64, err error) error {
+	if n > 0 {
+		this.touch()
+	}
+	if err != nil && this.expired.Load() {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
+
+func (this *sftpStream) Read(p []byte) (n int, err error) {
+	n, err = this.File.Read(p)
+	err = this.result(int64(n), err)
+	return
+}
+
+func (this *sftpStream) Write(p []byte) (n int, err error) {
+	n, err = this.File.Write(p)
+	err = this.result(int64(n), err)
+	return
+}
+
+// WriteTo and ReadFrom keep the concurrent requests of sftp.File for io.Copy.
+func (this *sftpStream) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = this.File.WriteTo(touchWriter{w, this.touch})
+	err = this.result(0, err)
+	return
+}
+
+func (this *sftpStream) ReadFrom(r io.Reader) (n int64, err error) {
+	n, err = this.File.ReadFrom(touchReader{r, this.touch})
+	err = this.result(0, err)
+	return
+}
+
+func (this *sftpStream) Close() (err error) {
+	if this.idle != nil {
+		this.idle.Stop()
+	}
+	if this.expired.Load() {
+		this.stop()
+		return os.ErrDeadlineExceeded
+	}
+	if !this.stop() {
+		return this.ctx.Err()
+	}
+	err = this.File.Close()
+	return
+}
+
+// ResumeDownload continues the download of remote from the size of the local file.
+func (this *SecureFtp) ResumeDownload(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.ResumeDownloadContext(context.Background(), local, remote)
+}
+
+func (this *SecureFtp) ResumeDownloadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	err = this.transfer(ctx, func(touch func()) (e error) {
+		len, e = this.resumeDownload(local, remote, touch)
+		return
+	})
+	return
+}
+
+// ResumeUpload continues the upload of local from the size of the remote file.
+func (this *SecureFtp) ResumeUpload(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.ResumeUploadContext(context.Background(), local, remote)
+}
+
+func (this *SecureFtp) ResumeUploadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	err = this.transfer(ctx, func(touch func()) (e error) {
+		len, e = this.resumeUpload(local, remote, touch)
+		return
+	})
+	return
+}
+
+// ListEntities lists dir in the structured form.
+func (this *SecureFtp) ListEntities(dir string) (res []*FtpResponse, ents []*Entity, err error) {
+	return this.ListEntitiesContext(context.Background(), dir)
+}
+
+func (this *SecureFtp) ListEntitiesContext(ctx context.Context, dir string) (res []*FtpResponse, ents []*Entity, err error) {
+	err = this.requests(ctx, func(touch func()) (e error) {
+		ents, e = this.listEntities(dir, touch)
+		return
+	})
+	return
+}
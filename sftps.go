@@ -1,95 +1,206 @@
 package sftps
 
 import (
+	"context"
 	"errors"
+	"io"
+	"sync"
+	"time"
 )
 
+// FtpResponse is a reply of the FTP server to Command.
 type FtpResponse struct {
-	command string
-	code    int
-	msg     string
+	Command string
+	Code    int
+	Msg     string
 }
 
+// PositivePreliminary reports whether the reply is 1xx, the action is started and another reply follows.
+func (this *FtpResponse) PositivePreliminary() bool {
+	return this.Code/100 == 1
+}
+
+// PositiveCompletion reports whether the reply is 2xx, the action is completed.
+func (this *FtpResponse) PositiveCompletion() bool {
+	return this.Code/100 == 2
+}
+
+// PositiveIntermediate reports whether the reply is 3xx, the server waits for the next command.
+func (this *FtpResponse) PositiveIntermediate() bool {
+	return this.Code/100 == 3
+}
+
+// TransientNegative reports whether the reply is 4xx, the same command may succeed later.
+func (this *FtpResponse) TransientNegative() bool {
+	return this.Code/100 == 4
+}
+
+// PermanentNegative reports whether the reply is 5xx, the command must not be repeated as is.
+func (this *FtpResponse) PermanentNegative() bool {
+	return this.Code/100 == 5
+}
+
+// Client is the set of operations every backend (FTP, FTPS, SFTP) provides.
+// The FtpResponse values are only filled by the FTP backends, SFTP always returns nil for them.
+// The methods without the Context suffix are the same as calling the Context one with context.Background().
+type Client interface {
+	Connect() (res []*FtpResponse, err error)
+	Quit() (res *FtpResponse, err error)
+	List(p string) (res []*FtpResponse, list string, err error)
+	ListEntities(dir string) (res []*FtpResponse, ents []*Entity, err error)
+	Mkdir(p string) (res []*FtpResponse, err error)
+	Rmdir(p string) (res []*FtpResponse, err error)
+	Rename(old string, new string) (res []*FtpResponse, err error)
+	Upload(local string, remote string) (res []*FtpResponse, len int64, err error)
+	Download(local string, remote string) (res []*FtpResponse, len int64, err error)
+	Stat(p string) (res []*FtpResponse, ent *Entity, err error)
+	Remove(p string) (res []*FtpResponse, err error)
+	UploadFrom(r io.Reader, remote string) (res []*FtpResponse, len int64, err error)
+	DownloadTo(w io.Writer, remote string) (res []*FtpResponse, len int64, err error)
+	OpenReader(remote string) (res []*FtpResponse, r io.ReadCloser, err error)
+	OpenWriter(remote string) (res []*FtpResponse, w io.WriteCloser, err error)
+	ResumeDownload(local string, remote string) (res []*FtpResponse, len int64, err error)
+	ResumeUpload(local string, remote string) (res []*FtpResponse, len int64, err error)
+
+	ConnectContext(ctx context.Context) (res []*FtpResponse, err error)
+	QuitContext(ctx context.Context) (res *FtpResponse, err error)
+	ListContext(ctx context.Context, p string) (res []*FtpResponse, list string, err error)
+	ListEntitiesContext(ctx context.Context, dir string) (res []*FtpResponse, ents []*Entity, err error)
+	MkdirContext(ctx context.Context, p string) (res []*FtpResponse, err error)
+	RmdirContext(ctx context.Context, p string) (res []*FtpResponse, err error)
+	RenameContext(ctx context.Context, old string, new string) (res []*FtpResponse, err error)
+	UploadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error)
+	DownloadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error)
+	StatContext(ctx context.Context, p string) (res []*FtpResponse, ent *Entity, err error)
+	RemoveContext(ctx context.Context, p string) (res []*FtpResponse, err error)
+	UploadFromContext(ctx context.Context, r io.Reader, remote string) (res []*FtpResponse, len int64, err error)
+	DownloadToContext(ctx context.Context, w io.Writer, remote string) (res []*FtpResponse, len int64, err error)
+	OpenReaderContext(ctx context.Context, remote string) (res []*FtpResponse, r io.ReadCloser, err error)
+	OpenWriterContext(ctx context.Context, remote string) (res []*FtpResponse, w io.WriteCloser, err error)
+	ResumeDownloadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error)
+	ResumeUploadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error)
+}
+
+var (
+	_ Client = (*Ftp)(nil)
+	_ Client = (*SecureFtp)(nil)
+)
+
 type Sftps struct {
-	state    int
-	protocol int
-	recv     interface{}
-	keepalive bool
-	isDebug  bool
+	state       int
+	protocol    int
+	client      Client
+	keepalive   bool
+	isDebug     bool
+	retryPolicy *RetryPolicy
+
+	mu                sync.Mutex // serializes the operations and the idle keepalive.
+	lastUsed          time.Time
+	streaming         bool // a reader or writer is open on the session.
+	keepAliveInterval time.Duration
+	stopKeepAlive     func()
 }
 
 func New(proto int, param interface{}) (sftps *Sftps, err error) {
-	sftps = new(Sftps)
+	var client Client
 
 	if proto == FTP || proto == FTPS {
-		var parameter *ftpParameters
 		if p, ok := param.(*ftpParameters); ok {
-			parameter = p
-			sftps.recv = newFtp(parameter)
-			sftps.keepalive = parameter.keepAlive
+			client = newFtp(p)
+			sftps = NewWithClient(client, p.keepAlive)
+			sftps.retryPolicy = p.retryPolicy
+			sftps.keepAliveInterval = p.keepAliveInterval
 		} else {
 			err = errors.New("the 'param' could not cast to the *ftpParameters type.")
 			return
 		}
 	} else if proto == SFTP {
-		var parameter *sftpParameters
 		if p, ok := param.(*sftpParameters); ok {
-			parameter = p
-			sftps.recv = newSftp(parameter)
-			sftps.keepalive = parameter.keepAlive
+			client = newSftp(p)
+			sftps = NewWithClient(client, p.keepAlive)
+			sftps.retryPolicy = p.retryPolicy
+			sftps.keepAliveInterval = p.keepAliveInterval
 		} else {
 			err = errors.New("the 'param' could not cast to the *sftpParameters type.")
+			return
 		}
 	} else {
 		err = errors.New("Invalid parameter were bound. the Protocol must be FTP, FTPS or SFTP")
 		return
 	}
 	sftps.protocol = proto
+	return
+}
+
+// NewWithClient wraps any Client implementation, e.g. a mock or a custom backend.
+func NewWithClient(client Client, keepalive bool) (sftps *Sftps) {
+	sftps = new(Sftps)
+	sftps.client = client
+	sftps.keepalive = keepalive
+	sftps.protocol = NONE
 	sftps.state = OFFLINE
 	return
 }
 
-func (this *Sftps) Connect() (res []*FtpResponse, err error) {
+// Retry sets the policy for retrying the operations failed by a transient error.
+func (this *Sftps) Retry(policy RetryPolicy) {
+	this.retryPolicy = &policy
+}
 
-	if this.protocol == FTP || this.protocol == FTPS {
-		var r *FtpResponse
-		if r, err = this.recv.(*Ftp).connect(); err != nil {
-			return
-		}
-		res = []*FtpResponse{}
-		res = append(res, r)
+// KeepAlive pings the idle session every interval while it is connected, zero disables it.
+func (this *Sftps) KeepAlive(interval time.Duration) {
+	this.keepAliveInterval = interval
+}
 
-		var rs []*FtpResponse
-		if rs, err = this.recv.(*Ftp).auth(); err != nil {
-			return
-		}
-		res = append(res, rs...)
+// Features returns the features the server advertised, the FEAT reply on FTP and the extensions on SFTP,
+// nil if the backend does not tell them.
+func (this *Sftps) Features() (features Features) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if f, ok := this.client.(featurer); ok {
+		features = f.Features()
+	}
+	return
+}
 
-		if rs, err = this.recv.(*Ftp).options(); err != nil {
-			return
-		}
-		res = append(res, rs...)
-	} else
-	if this.protocol == SFTP {
-		if err = this.recv.(*SecureFtp).connect(); err != nil {
+// featurer is implemented by the backends that tell the features of the server.
+type featurer interface {
+	Features() Features
+}
+
+// Client returns the underlying backend.
+func (this *Sftps) Client() Client {
+	return this.client
+}
+
+func (this *Sftps) Connect() (res []*FtpResponse, err error) {
+	return this.ConnectContext(context.Background())
+}
+
+func (this *Sftps) ConnectContext(ctx context.Context) (res []*FtpResponse, err error) {
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		if attempt > 1 && this.state == ONLINE { // connected again by the retry.
 			return
 		}
+		res, e = this.client.ConnectContext(ctx)
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
 	}
-
 	this.state = ONLINE
+	this.startKeepAlive()
 	return
 }
 
 func (this *Sftps) Quit() (res *FtpResponse, err error) {
-	if this.protocol == FTP || this.protocol == FTPS {
-		if res, err = this.recv.(*Ftp).quit(); err != nil {
-			return
-		}
-	} else
-	if this.protocol == SFTP {
-		if err = this.recv.(*SecureFtp).quit(); err != nil {
-			return
-		}
+	return this.QuitContext(context.Background())
+}
+
+func (this *Sftps) QuitContext(ctx context.Context) (res *FtpResponse, err error) {
+	this.endKeepAlive()
+	if res, err = this.client.QuitContext(ctx); err != nil {
+		return
 	}
 	this.state = OFFLINE
 	return
@@ -100,167 +211,150 @@ func (this *Sftps) StringToEntities(raw string) (ents []*Entity, err error) {
 	return
 }
 
-func (this *Sftps) List(baseDir string) (res []*FtpResponse, list string, err error) {
-
+func (this *Sftps) online() (err error) {
 	if this.state == OFFLINE {
-		err = errors.New("Connection is not established.")
+		err = ErrNotConnected
+	}
+	return
+}
+
+// failed marks the session closed when the operation was aborted by ctx, the backends tear
+// the connection down in that case. Otherwise the session is closed unless the keepalive was specified,
+// the error of the quit is dropped in favor of the one of the operation.
+func (this *Sftps) failed(ctx context.Context) {
+	if ctx.Err() != nil {
+		this.endKeepAlive()
+		this.state = OFFLINE
 		return
 	}
-	if this.protocol == FTP || this.protocol == FTPS {
-		var ftp *Ftp
-		if recv, ok := this.recv.(*Ftp); ok {
-			ftp = recv
-		}
-		if res, list, err = ftp.list(baseDir); err != nil {
-			return
-		} else {
-			var r *FtpResponse
-			if !this.keepalive {
-				if r, err = ftp.quit(); err != nil {
-					return
-				}
-			}
-			res = append(res, r)
-		}
-	} else
-	if this.protocol == SFTP {
-		var sftp *SecureFtp
-		if recv, ok := this.recv.(*SecureFtp); ok {
-			sftp = recv
-		}
-		if list, err = sftp.list(baseDir); err != nil {
-			return
-		}
+	if !this.keepalive && this.state == ONLINE {
+		this.endKeepAlive()
+		this.client.QuitContext(context.Background())
+		this.state = OFFLINE
+	}
+}
 
-		if !this.keepalive {
-			if err = sftp.quit(); err != nil {
-				return
-			}
-		}
+// ping checks the session is alive if the backend supports it.
+func (this *Sftps) ping(ctx context.Context) (err error) {
+	if p, ok := this.client.(pinger); ok {
+		err = p.ping(ctx)
 	}
 	return
 }
 
+type pinger interface {
+	ping(ctx context.Context) error
+}
 
-func (this *Sftps) Mkdir(p string) (res []*FtpResponse, err error) {
-	if this.state == OFFLINE {
-		err = errors.New("Connection is not established.")
+// done closes the session after an operation unless the keepalive was specified.
+func (this *Sftps) done(res []*FtpResponse) (rs []*FtpResponse, err error) {
+	rs = res
+	if this.keepalive {
 		return
 	}
-	if this.protocol == FTP || this.protocol == FTPS {
-		var ftp *Ftp
-		var r *FtpResponse
-		res = new([]*FtpResponse)
-		if recv, ok := this.recv.(*Ftp); ok {
-			ftp = recv
-		}
-		if r, err = ftp.mkdir(p); err != nil {
-			return
-		}
-		res = append(res, r)
+	var r *FtpResponse
+	if r, err = this.Quit(); err != nil {
+		return
+	}
+	if r != nil {
+		rs = append(rs, r)
+	}
+	return
+}
 
-		if !this.keepalive {
-			if r, err = ftp.quit(); err != nil {
-				return
-			}
-			res = append(res, r)
-		}
-	} else
-	if this.protocol == SFTP {
-		var sftp *SecureFtp
-		if recv, ok := this.recv.(*SecureFtp); ok {
-			sftp = recv
-		}
-		if err = sftp.mkdir(p); err != nil {
-			return
-		}
+func (this *Sftps) List(baseDir string) (res []*FtpResponse, list string, err error) {
+	return this.ListContext(context.Background(), baseDir)
+}
 
-		if !this.keepalive {
-			if err = sftp.quit(); err != nil {
-				return
-			}
-		}
+func (this *Sftps) ListContext(ctx context.Context, baseDir string) (res []*FtpResponse, list string, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, list, e = this.client.ListContext(ctx, baseDir)
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
 	}
+	res, err = this.done(res)
 	return
 }
 
-func (this *Sftps) Rmdir(p string) (res []*FtpResponse, err error) {
-	if this.state == OFFLINE {
-		err = errors.New("Connection is not established.")
+// ListEntities lists dir in the structured form, by MLSD on the FTP servers supporting it.
+func (this *Sftps) ListEntities(dir string) (res []*FtpResponse, ents []*Entity, err error) {
+	return this.ListEntitiesContext(context.Background(), dir)
+}
+
+func (this *Sftps) ListEntitiesContext(ctx context.Context, dir string) (res []*FtpResponse, ents []*Entity, err error) {
+	if err = this.online(); err != nil {
 		return
 	}
-	if this.protocol == FTP || this.protocol == FTPS {
-		res = new([]*FtpResponse)
-		var r *FtpResponse
-		var ftp *Ftp
-		if recv, ok := this.recv.(*Ftp); ok {
-			ftp = recv
-		}
-		if r, err = ftp.rmdir(p); err != nil {
-			return
-		}
-		res = append(res, r)
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, ents, e = this.client.ListEntitiesContext(ctx, dir)
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
+	}
+	res, err = this.done(res)
+	return
+}
 
-		if !this.keepalive {
-			if r, err = ftp.quit(); err != nil {
-				return
-			}
-			res = append(res, r)
-		}
-	} else
-	if this.protocol == SFTP {
-		var sftp *SecureFtp
-		if recv, ok := this.recv.(*SecureFtp); ok {
-			sftp = recv
-		}
-		if err = sftp.remove(p); err != nil {
-			return
-		}
-		if !this.keepalive {
-			if err = sftp.quit(); err != nil {
-				return
-			}
-		}
+func (this *Sftps) Mkdir(p string) (res []*FtpResponse, err error) {
+	return this.MkdirContext(context.Background(), p)
+}
+
+func (this *Sftps) MkdirContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, e = this.client.MkdirContext(ctx, p)
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
 	}
+	res, err = this.done(res)
 	return
 }
 
-func (this *Sftps) Rename(old string, new string) (res []*FtpResponse, err error) {
-	if this.state == OFFLINE {
-		err = errors.New("Connection is not established")
+func (this *Sftps) Rmdir(p string) (res []*FtpResponse, err error) {
+	return this.RmdirContext(context.Background(), p)
+}
+
+func (this *Sftps) RmdirContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, e = this.client.RmdirContext(ctx, p)
+		return
+	}); err != nil {
+		this.failed(ctx)
 		return
 	}
+	res, err = this.done(res)
+	return
+}
 
-	if this.protocol == FTP || this.protocol == FTPS {
-		var ftp *Ftp
-		if recv, ok := this.recv.(*Ftp); ok {
-			ftp = recv
-		}
-		if res, err = ftp.rename(old, new); err != nil {
-			return
-		}
-		if !this.keepalive {
-			var r *FtpResponse
-			if r, err = ftp.quit(); err != nil {
-				return
-			}
-			res = append(res, r)
-		}
-	} else
-	if this.protocol == SFTP {
-		var sftp *SecureFtp
-		if recv, ok := this.recv.(*SecureFtp); ok {
-			sftp = recv
-		}
-		if err = sftp.rename(old, new); err != nil {
-			return
-		}
-		if !this.keepalive {
-			if err = sftp.quit(); err != nil {
-				return
-			}
-		}
+func (this *Sftps) Rename(old string, new string) (res []*FtpResponse, err error) {
+	return this.RenameContext(context.Background(), old, new)
+}
+
+func (this *Sftps) RenameContext(ctx context.Context, old string, new string) (res []*FtpResponse, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, e = this.client.RenameContext(ctx, old, new)
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
 	}
+	res, err = this.done(res)
 	return
 }
 
@@ -268,81 +362,264 @@ func (this *Sftps) Rename(old string, new string) (res []*FtpResponse, err error
 	parameter's explain. local is the local path for the file, whether remote.
  */
 func (this *Sftps) Upload(local string, remote string) (res []*FtpResponse, len int64, err error) {
-	if this.state == OFFLINE {
-		err = errors.New("Connection is not established")
+	return this.UploadContext(context.Background(), local, remote)
+}
+
+func (this *Sftps) UploadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		// the length counts the bytes transferred by every attempt.
+		var n int64
+		if attempt > 1 {
+			res, n, e = this.client.ResumeUploadContext(ctx, local, remote)
+		} else {
+			res, n, e = this.client.UploadContext(ctx, local, remote)
+		}
+		len += n
+		return
+	}); err != nil {
+		this.failed(ctx)
 		return
 	}
+	res, err = this.done(res)
+	return
+}
 
-	if this.protocol == FTP || this.protocol == FTPS {
-		var ftp *Ftp
-		var r *FtpResponse
+func (this *Sftps) Download(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.DownloadContext(context.Background(), local, remote)
+}
 
-		if recv, ok := this.recv.(*Ftp); ok {
-			ftp = recv
-		}
-		if res, len, err = ftp.upload(local, remote); err != nil {
-			return
-		}
-		if !this.keepalive {
-			if r, err = ftp.quit(); err != nil {
-				return
-			}
-			res = append(res, r)
-		}
-	} else
-	if this.protocol == SFTP {
-		var sftp *SecureFtp
-		if recv, ok := this.recv.(*SecureFtp); ok {
-			sftp = recv
-		}
-		if len, err = sftp.upload(local, remote); err != nil {
-			return
-		}
-		if !this.keepalive {
-			if err = sftp.quit(); err != nil {
-				return
-			}
+func (this *Sftps) DownloadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		// the length counts the bytes transferred by every attempt.
+		var n int64
+		if attempt > 1 {
+			res, n, e = this.client.ResumeDownloadContext(ctx, local, remote)
+		} else {
+			res, n, e = this.client.DownloadContext(ctx, local, remote)
 		}
+		len += n
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
 	}
+	res, err = this.done(res)
 	return
 }
 
-func (this *Sftps) Download(local string, remote string) (res []*FtpResponse, len int64, err error) {
-	if this.state == OFFLINE {
-		err = errors.New("Connection is not established")
+func (this *Sftps) Stat(p string) (res []*FtpResponse, ent *Entity, err error) {
+	return this.StatContext(context.Background(), p)
+}
+
+func (this *Sftps) StatContext(ctx context.Context, p string) (res []*FtpResponse, ent *Entity, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, ent, e = this.client.StatContext(ctx, p)
+		return
+	}); err != nil {
+		this.failed(ctx)
 		return
 	}
+	res, err = this.done(res)
+	return
+}
 
-	if this.protocol == FTP || this.protocol == FTPS {
-		var ftp *Ftp
-		var r *FtpResponse
+func (this *Sftps) Remove(p string) (res []*FtpResponse, err error) {
+	return this.RemoveContext(context.Background(), p)
+}
 
-		if recv, ok := this.recv.(*Ftp); ok {
-			ftp = recv
-		}
-		if res, len, err = ftp.download(local, remote); err != nil {
-			return
-		}
-		if !this.keepalive {
-			if r, err = ftp.quit(); err != nil {
-				return
-			}
-			res = append(res, r)
+func (this *Sftps) RemoveContext(ctx context.Context, p string) (res []*FtpResponse, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, e = this.client.RemoveContext(ctx, p)
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
+	}
+	res, err = this.done(res)
+	return
+}
+
+func (this *Sftps) UploadFrom(r io.Reader, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.UploadFromContext(context.Background(), r, remote)
+}
+
+func (this *Sftps) UploadFromContext(ctx context.Context, r io.Reader, remote string) (res []*FtpResponse, len int64, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	// the bytes read from r count, the backends read ahead of the bytes the server took.
+	cr := &countingReader{Reader: r}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, len, e = this.client.UploadFromContext(ctx, cr, remote)
+		if e != nil && cr.n > 0 { // the stream cannot be rewound.
+			e = &finalError{err: e}
 		}
-	} else
-	if this.protocol == SFTP {
-		var sftp *SecureFtp
-		if recv, ok := this.recv.(*SecureFtp); ok {
-			sftp = recv
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
+	}
+	res, err = this.done(res)
+	return
+}
+
+func (this *Sftps) DownloadTo(w io.Writer, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.DownloadToContext(context.Background(), w, remote)
+}
+
+func (this *Sftps) DownloadToContext(ctx context.Context, w io.Writer, remote string) (res []*FtpResponse, len int64, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, len, e = this.client.DownloadToContext(ctx, w, remote)
+		if e != nil && len > 0 { // the stream cannot be rewound.
+			e = &finalError{err: e}
 		}
-		if len, err = sftp.download(local, remote); err != nil {
-			return
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
+	}
+	res, err = this.done(res)
+	return
+}
+
+// OpenReader returns the content of remote as a stream,
+// the session is closed along with the reader unless the keepalive was specified.
+// The session must not be used for the other operations until the reader is closed.
+func (this *Sftps) OpenReader(remote string) (res []*FtpResponse, r io.ReadCloser, err error) {
+	return this.OpenReaderContext(context.Background(), remote)
+}
+
+func (this *Sftps) OpenReaderContext(ctx context.Context, remote string) (res []*FtpResponse, r io.ReadCloser, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		if res, r, e = this.client.OpenReaderContext(ctx, remote); e == nil {
+			this.streaming = true
 		}
-		if !this.keepalive {
-			if err = sftp.quit(); err != nil {
-				return
-			}
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
+	}
+	r = &sessionReadCloser{ReadCloser: r, sftps: this}
+	return
+}
+
+// OpenWriter returns a stream that is stored to remote,
+// the session is closed along with the writer unless the keepalive was specified.
+func (this *Sftps) OpenWriter(remote string) (res []*FtpResponse, w io.WriteCloser, err error) {
+	return this.OpenWriterContext(context.Background(), remote)
+}
+
+func (this *Sftps) OpenWriterContext(ctx context.Context, remote string) (res []*FtpResponse, w io.WriteCloser, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		if res, w, e = this.client.OpenWriterContext(ctx, remote); e == nil {
+			this.streaming = true
 		}
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
+	}
+	w = &sessionWriteCloser{WriteCloser: w, sftps: this}
+	return
+}
+
+// ResumeDownload continues an interrupted download, the bytes already in local are not transferred again.
+func (this *Sftps) ResumeDownload(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.ResumeDownloadContext(context.Background(), local, remote)
+}
+
+func (this *Sftps) ResumeDownloadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, len, e = this.client.ResumeDownloadContext(ctx, local, remote)
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
+	}
+	res, err = this.done(res)
+	return
+}
+
+// ResumeUpload continues an interrupted upload, the bytes already in remote are not transferred again.
+func (this *Sftps) ResumeUpload(local string, remote string) (res []*FtpResponse, len int64, err error) {
+	return this.ResumeUploadContext(context.Background(), local, remote)
+}
+
+func (this *Sftps) ResumeUploadContext(ctx context.Context, local string, remote string) (res []*FtpResponse, len int64, err error) {
+	if err = this.online(); err != nil {
+		return
+	}
+	if err = this.retry(ctx, func(attempt int) (e error) {
+		res, len, e = this.client.ResumeUploadContext(ctx, local, remote)
+		return
+	}); err != nil {
+		this.failed(ctx)
+		return
+	}
+	res, err = this.done(res)
+	return
+}
+
+// closeStream tells the stream on the session was closed.
+func (this *Sftps) closeStream() {
+	this.mu.Lock()
+	this.streaming = false
+	this.lastUsed = time.Now()
+	this.mu.Unlock()
+}
+
+// sessionReadCloser ends the stream on the session, and closes the session unless the keepalive was specified.
+type sessionReadCloser struct {
+	io.ReadCloser
+	sftps *Sftps
+}
+
+func (this *sessionReadCloser) Close() (err error) {
+	err = this.ReadCloser.Close()
+	this.sftps.closeStream()
+	if err != nil {
+		return
+	}
+	_, err = this.sftps.done(nil)
+	return
+}
+
+// sessionWriteCloser is the same as sessionReadCloser for the writer.
+type sessionWriteCloser struct {
+	io.WriteCloser
+	sftps *Sftps
+}
+
+func (this *sessionWriteCloser) Close() (err error) {
+	err = this.WriteCloser.Close()
+	this.sftps.closeStream()
+	if err != nil {
+		return
 	}
+	_, err = this.sftps.done(nil)
 	return
 }
@@ -0,0 +1,95 @@
+package sftps
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// Timeouts bounds the waits on the connections of a session, the same for FTP, FTPS and SFTP.
+// A zero field is the default and a negative one disables the bound. The deadline of the context
+// of the operation applies as well, whichever comes first.
+type Timeouts struct {
+	Dial         time.Duration // connecting to the server, 10s by default.
+	Handshake    time.Duration // the TLS handshake of FTPS, the SSH handshake and authentication of SFTP, 10s by default.
+	Reply        time.Duration // each reply to a control command or to an SFTP request other than the transfer, 60s by default.
+	DataConn     time.Duration // establishing the data connection of FTP by PASV or PORT, 10s by default.
+	DataIdle     time.Duration // no byte is transferred by the data connection or the SFTP transfer, 60s by default.
+	TCPKeepAlive time.Duration // the keep-alive period of TCP, 30s by default.
+}
+
+const (
+	defaultDialTimeout      = 10 * time.Second
+	defaultHandshakeTimeout = 10 * time.Second
+	defaultReplyTimeout     = 60 * time.Second
+	defaultDataConnTimeout  = 10 * time.Second
+	defaultDataIdleTimeout  = 60 * time.Second
+	defaultTCPKeepAlive     = 30 * time.Second
+)
+
+func timeoutOr(d time.Duration, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (this Timeouts) dial() time.Duration {
+	return timeoutOr(this.Dial, defaultDialTimeout)
+}
+
+func (this Timeouts) handshake() time.Duration {
+	return timeoutOr(this.Handshake, defaultHandshakeTimeout)
+}
+
+func (this Timeouts) reply() time.Duration {
+	return timeoutOr(this.Reply, defaultReplyTimeout)
+}
+
+func (this Timeouts) dataConn() time.Duration {
+	return timeoutOr(this.DataConn, defaultDataConnTimeout)
+}
+
+func (this Timeouts) dataIdle() time.Duration {
+	return timeoutOr(this.DataIdle, defaultDataIdleTimeout)
+}
+
+// dialer returns the dialer by the timeouts, timeout bounds the connecting.
+func (this Timeouts) dialer(timeout time.Duration) *net.Dialer {
+	keepAlive := timeoutOr(this.TCPKeepAlive, defaultTCPKeepAlive)
+	if keepAlive == 0 {
+		keepAlive = -1 // disabled, zero of net.Dialer means the default.
+	}
+	return &net.Dialer{Timeout: timeout, KeepAlive: keepAlive}
+}
+
+// touchReader calls touch on every progress of the read, to restart the idle timeout.
+type touchReader struct {
+	io.Reader
+	touch func()
+}
+
+func (this touchReader) Read(p []byte) (n int, err error) {
+	n, err = this.Reader.Read(p)
+	if n > 0 {
+		this.touch()
+	}
+	return
+}
+
+// touchWriter calls touch on every progress of the write, to restart the idle timeout.
+type touchWriter struct {
+	io.Writer
+	touch func()
+}
+
+func (this touchWriter) Write(p []byte) (n int, err error) {
+	n, err = this.Writer.Write(p)
+	if n > 0 {
+		this.touch()
+	}
+	return
+}